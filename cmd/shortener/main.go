@@ -2,38 +2,170 @@ package main
 
 import (
 	"context"
+	crand "crypto/rand"
+	"expvar"
+	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
 	"shortener/internal/cache"
+	"shortener/internal/clicks"
 	"shortener/internal/config"
+	"shortener/internal/domain"
+	"shortener/internal/journal"
 	"shortener/internal/logger"
+	"shortener/internal/policy"
 	memoryrepo "shortener/internal/repo/memory"
+	sqliterepo "shortener/internal/repo/sqlite"
 	service "shortener/internal/service/shortener"
+	"shortener/internal/trending"
 	httphandler "shortener/internal/web"
 )
 
 func main() {
-	cfg := config.LoadConfig()
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
 
 	asyncH := logger.NewAsyncHandler(slog.NewTextHandler(os.Stdout, nil), 100)
 	lg := slog.New(asyncH)
 
-	repo := memoryrepo.New()
+	st, err := openStorage(cfg)
+	if err != nil {
+		log.Fatalf("open storage: %v", err)
+	}
 
-	if err := repo.Migrate(context.Background()); err != nil {
+	if err := st.urls.Migrate(context.Background()); err != nil {
 		log.Fatalf("migrate: %v", err)
 	}
+	if err := st.analytics.Migrate(context.Background()); err != nil {
+		log.Fatalf("migrate analytics: %v", err)
+	}
+
+	trend := trending.New(200)
+
+	if !domain.ValidRedirectStatus(cfg.RedirectStatus) {
+		log.Fatalf("config: redirect status %d is not one of 301, 302, 307, 308", cfg.RedirectStatus)
+	}
+
+	svcOpts := []service.Option{
+		service.WithMaxTTL(cfg.MaxTTL),
+		service.WithDefaultRedirect(cfg.RedirectStatus),
+		service.WithURLRules(cfg.URLSchemes, cfg.MaxURLLength),
+		service.WithAnalytics(st.analytics),
+		service.WithTrending(trend),
+	}
+
+	baseURL, err := parseBaseURL(cfg.BaseURL)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	svcOpts = append(svcOpts, service.WithSelfLinkGuard(baseURL, cfg.AliasDomains, cfg.SelfLinkDepth))
+
+	pol, err := policy.NewEngine(cfg.PolicyPath)
+	if err != nil {
+		log.Fatalf("load policy: %v", err)
+	}
+	svcOpts = append(svcOpts, service.WithPolicy(pol))
+
+	gen, err := newCodeGenerator(cfg)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	svcOpts = append(svcOpts,
+		service.WithCodeGenerator(gen),
+		service.WithAdaptiveLength(cfg.CodeLength, cfg.CodeMaxLength),
+	)
+
+	if cfg.Dedup {
+		svcOpts = append(svcOpts, service.WithDedup())
+	}
+
+	var codeFilter service.CodeFilter
+	if cfg.CodeBlocklistPath != "" {
+		bl, err := service.LoadBlocklist(cfg.CodeBlocklistPath)
+		if err != nil {
+			log.Fatalf("config: %v", err)
+		}
+		log.Printf("loaded %d blocked words from %s", bl.Len(), cfg.CodeBlocklistPath)
+		codeFilter = bl
+		svcOpts = append(svcOpts, service.WithCodeFilter(bl))
+	}
+
+	var writeBehind *service.WriteBehind
+	if cfg.AsyncCreate {
+		j, err := journal.Open(cfg.JournalPath, journal.Options{})
+		if err != nil {
+			log.Fatalf("open journal: %v", err)
+		}
+		defer j.Close()
+
+		writeBehind = service.NewWriteBehind(st.urls, j, service.WriteBehindConfig{Generator: gen, Filter: codeFilter}, lg)
+		restored, err := writeBehind.Recover(context.Background())
+		if err != nil {
+			log.Fatalf("recover journal: %v", err)
+		}
+		if restored > 0 {
+			log.Printf("restored %d links from journal %s", restored, cfg.JournalPath)
+		}
+		writeBehind.Start()
+		expvar.Publish("write_behind", expvar.Func(func() any { return writeBehind.Stats() }))
+		svcOpts = append(svcOpts, service.WithWriteBehind(writeBehind))
+	}
+
+	// клики по ещё не записанной ссылке сначала дописывают её в хранилище
+	var clickStore clicks.Store = st.urls
+	if writeBehind != nil {
+		clickStore = writeBehind
+	}
+	clickAgg := clicks.NewAggregator(clickStore, cfg.ClickFlushInterval, lg)
+	clickAgg.Start()
+	clickLog := clicks.NewEventWriter(st.analytics, cfg.ClickFlushInterval, 1000, lg)
+	clickLog.Start()
+	clickUniq := clicks.NewUniqueTracker(st.analytics, cfg.ClickFlushInterval, lg)
+	clickUniq.Start()
+
+	overflow, err := clickOverflow(cfg)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	clickPipe := clicks.NewPipeline(clicks.PipelineConfig{
+		QueueSize:    cfg.ClickQueueSize,
+		Workers:      cfg.ClickWorkers,
+		Overflow:     overflow,
+		BlockTimeout: cfg.ClickBlockTimeout,
+	}, lg, clickAgg, clickLog, clickUniq, trend)
+	expvar.Publish("clicks", expvar.Func(func() any { return clickPipe.Stats() }))
+
+	svcOpts = append(svcOpts, service.WithClickRecorder(clickPipe))
 
 	c := cache.NewURLCache(100_000)
-	svc := service.NewURLService(repo, c, lg)
+	svc := service.NewURLService(st.urls, c, lg, svcOpts...)
+	if r, ok := svc.(service.CodeStatsReporter); ok {
+		expvar.Publish("codes", expvar.Func(func() any { return r.CodeStats() }))
+	}
 
-	h := httphandler.NewHandler(svc, lg)
+	// держим в кэше самые популярные за 5 минут ссылки
+	warmer := trending.NewWarmer(trend, st.urls, c, 5*time.Minute, 1000, 30*time.Second, lg)
+	warmer.Start()
+
+	salt, err := ipHashSalt(context.Background(), cfg, st.analytics)
+	if err != nil {
+		log.Fatalf("ip hash salt: %v", err)
+	}
+	hOpts, err := handlerOptions(cfg, baseURL, gen, salt)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	h := httphandler.NewHandler(svc, lg, hOpts...)
 	mux := http.NewServeMux()
 	h.RegisterRoutes(mux)
 
@@ -43,12 +175,43 @@ func main() {
 	}
 
 	go func() {
-		log.Printf("Listening on %s", srv.Addr)
+		log.Printf("Listening on %s (storage: %s)", srv.Addr, cfg.Storage)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("listen: %v", err)
 		}
 	}()
 
+	// метрики раскрывают командную строку и внутренние счётчики, поэтому
+	// отдаются только на отдельном служебном адресе
+	var admin *http.Server
+	if cfg.AdminAddr != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/debug/vars", expvar.Handler())
+		admin = &http.Server{
+			Addr:    cfg.AdminAddr,
+			Handler: adminMux,
+		}
+		go func() {
+			log.Printf("Admin listening on %s", admin.Addr)
+			if err := admin.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("admin listen: %v", err)
+			}
+		}()
+	}
+
+	// SIGHUP — перечитать правила для адресов назначения
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := pol.Reload(); err != nil {
+				log.Printf("reload policy: %v", err)
+				continue
+			}
+			log.Printf("policy reloaded from %q", pol.Path())
+		}
+	}()
+
 	// Graceful shutdown
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
@@ -59,4 +222,154 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Printf("server shutdown: %v", err)
 	}
+	if admin != nil {
+		if err := admin.Shutdown(ctx); err != nil {
+			log.Printf("admin server shutdown: %v", err)
+		}
+	}
+
+	warmer.Close()
+
+	if writeBehind != nil {
+		if err := writeBehind.Close(ctx); err != nil {
+			log.Printf("write-behind: %v", err)
+		}
+	}
+
+	// Дожидаемся доставки оставшихся кликов и сбрасываем счётчики в хранилище
+	if err := clickPipe.Close(ctx); err != nil {
+		log.Printf("flush clicks: %v", err)
+	}
+
+	// Хранилище закрываем только после того, как сервер перестал принимать запросы
+	if err := st.close(); err != nil {
+		log.Printf("close storage: %v", err)
+	}
+}
+
+type storage struct {
+	urls      domain.URLRepository
+	analytics domain.AnalyticsRepository
+	close     func() error // закрывает связанные ресурсы (например, *sql.DB)
+}
+
+// openStorage создаёт репозитории согласно cfg.Storage.
+func openStorage(cfg *config.Config) (*storage, error) {
+	switch cfg.Storage {
+	case config.StorageMemory:
+		return &storage{
+			urls:      memoryrepo.New(),
+			analytics: memoryrepo.NewAnalytics(),
+			close:     func() error { return nil },
+		}, nil
+
+	case config.StorageSQLite:
+		if dir := filepath.Dir(cfg.DBPath); dir != "" {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return nil, fmt.Errorf("create db dir: %w", err)
+			}
+		}
+		db, err := sqliterepo.Open(cfg.DBPath)
+		if err != nil {
+			return nil, fmt.Errorf("open sqlite %q: %w", cfg.DBPath, err)
+		}
+		return &storage{
+			urls:      sqliterepo.New(db),
+			analytics: sqliterepo.NewAnalytics(db),
+			close:     db.Close,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown storage %q (want %s|%s)", cfg.Storage, config.StorageMemory, config.StorageSQLite)
+	}
+}
+
+// clickOverflow возвращает политику переполнения очереди кликов согласно cfg.ClickOverflow.
+func clickOverflow(cfg *config.Config) (clicks.OverflowPolicy, error) {
+	switch cfg.ClickOverflow {
+	case config.ClickOverflowDrop:
+		return clicks.DropOnOverflow, nil
+	case config.ClickOverflowBlock:
+		return clicks.BlockOnOverflow, nil
+	default:
+		return 0, fmt.Errorf("unknown click overflow policy %q (want %s|%s)", cfg.ClickOverflow,
+			config.ClickOverflowDrop, config.ClickOverflowBlock)
+	}
+}
+
+// newCodeGenerator создаёт генератор коротких кодов согласно cfg.CodeStrategy.
+func newCodeGenerator(cfg *config.Config) (service.CodeGenerator, error) {
+	var opts []service.GenOption
+	var alphabet *service.Alphabet
+	switch cfg.CodeAlphabet {
+	case config.CodeAlphabetBase64URL:
+		alphabet = service.Base64URL
+	case config.CodeAlphabetCrockford:
+		alphabet = service.Crockford32
+	default:
+		return nil, fmt.Errorf("unknown code alphabet %q (want %s|%s)", cfg.CodeAlphabet,
+			config.CodeAlphabetBase64URL, config.CodeAlphabetCrockford)
+	}
+	opts = append(opts, service.WithAlphabet(alphabet))
+	if cfg.CodeCheckChar {
+		if !alphabet.SupportsCheckChar() {
+			return nil, fmt.Errorf("check character is not supported for alphabet %s", alphabet.Name())
+		}
+		opts = append(opts, service.WithCheckChar())
+	}
+
+	switch cfg.CodeStrategy {
+	case config.CodeStrategyRandom:
+		return service.NewRandomGenerator(cfg.CodeLength, opts...), nil
+	case config.CodeStrategyFeistel:
+		return service.NewFeistelGenerator([]byte(cfg.CodeKey), opts...)
+	case config.CodeStrategySnowflake:
+		return service.NewSnowflake(cfg.NodeID, opts...)
+	case config.CodeStrategyHash:
+		return service.NewHashGenerator(cfg.CodeLength, opts...), nil
+	default:
+		return nil, fmt.Errorf("unknown code strategy %q (want %s|%s|%s|%s)", cfg.CodeStrategy,
+			config.CodeStrategyRandom, config.CodeStrategyFeistel, config.CodeStrategySnowflake, config.CodeStrategyHash)
+	}
+}
+
+// parseBaseURL разбирает публичный адрес сервиса. Пустая строка — адрес не
+// задан (nil): short_url строится из запроса.
+func parseBaseURL(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	return httphandler.ParseBaseURL(raw)
+}
+
+// handlerOptions собирает настройки HTTP-обработчика. X-Forwarded-* от
+// доверенных прокси учитываются, только если базовый URL не задан.
+func handlerOptions(cfg *config.Config, baseURL *url.URL, gen service.CodeGenerator, salt []byte) ([]httphandler.Option, error) {
+	proxies, err := httphandler.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	if baseURL != nil && len(proxies) > 0 {
+		log.Printf("config: base url %s is set, X-Forwarded-* headers from trusted proxies are ignored", baseURL)
+	}
+	return []httphandler.Option{
+		httphandler.WithBaseURL(baseURL),
+		httphandler.WithTrustedProxies(proxies),
+		httphandler.WithIPHashSalt(salt),
+		httphandler.WithCodeNormalizer(gen.Format().Normalize),
+	}, nil
+}
+
+// ipHashSalt возвращает соль из конфига, а без неё — случайную, созданную
+// один раз и сохранённую в хранилище аналитики: хэши IP остаются
+// сопоставимыми между перезапусками, но их нельзя перебрать по словарю адресов.
+func ipHashSalt(ctx context.Context, cfg *config.Config, analytics domain.AnalyticsRepository) ([]byte, error) {
+	if cfg.IPHashSalt != "" {
+		return []byte(cfg.IPHashSalt), nil
+	}
+	candidate := make([]byte, 32)
+	if _, err := crand.Read(candidate); err != nil {
+		return nil, err
+	}
+	return analytics.IPHashSalt(ctx, candidate)
 }
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"shortener/internal/cache"
+	"shortener/internal/config"
+	"shortener/internal/logger"
+	memoryrepo "shortener/internal/repo/memory"
+	service "shortener/internal/service/shortener"
+	httphandler "shortener/internal/web"
+)
+
+func TestShortURLWiring(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want string
+	}{
+		{name: "request host", cfg: config.Config{}, want: "http://127.0.0.1:"},
+		{name: "trusted proxy", cfg: config.Config{TrustedProxies: []string{"127.0.0.0/8"}}, want: "https://short.example.com/"},
+		{
+			name: "base url wins",
+			cfg:  config.Config{BaseURL: "https://go.example.com/s/", TrustedProxies: []string{"127.0.0.0/8"}},
+			want: "https://go.example.com/s/",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			baseURL, err := parseBaseURL(tc.cfg.BaseURL)
+			if err != nil {
+				t.Fatalf("parse base url: %v", err)
+			}
+			opts, err := handlerOptions(&tc.cfg, baseURL, service.NewRandomGenerator(8), nil)
+			if err != nil {
+				t.Fatalf("handler options: %v", err)
+			}
+
+			svc := service.NewURLService(memoryrepo.New(), cache.NewURLCache(16), logger.NewNoopLogger())
+			mux := http.NewServeMux()
+			httphandler.NewHandler(svc, logger.NewNoopLogger(), opts...).RegisterRoutes(mux)
+			ts := httptest.NewServer(mux)
+			defer ts.Close()
+
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/shorten", bytes.NewBufferString(`{"url":"https://example.com/a"}`))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Forwarded-Proto", "https")
+			req.Header.Set("X-Forwarded-Host", "short.example.com")
+
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatalf("shorten: %v", err)
+			}
+			defer resp.Body.Close()
+
+			var out struct {
+				ShortURL string `json:"short_url"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+				t.Fatalf("decode (status %d): %v", resp.StatusCode, err)
+			}
+			if !strings.HasPrefix(out.ShortURL, tc.want) {
+				t.Fatalf("short_url = %s, want prefix %s", out.ShortURL, tc.want)
+			}
+		})
+	}
+}
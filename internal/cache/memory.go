@@ -3,11 +3,19 @@ package cache
 import (
 	"container/list"
 	"sync"
+	"time"
+
+	"shortener/internal/domain"
 )
 
 type entry struct {
-	key   string
-	value string
+	key      string
+	value    domain.Redirect
+	deadline time.Time // нулевое значение — без срока
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.deadline.IsZero() && !now.Before(e.deadline)
 }
 
 type URLCache struct {
@@ -15,6 +23,11 @@ type URLCache struct {
 	ll    *list.List
 	cache map[string]*list.Element
 	max   int
+
+	// gen увеличивается при каждой инвалидации. Читатель, загрузивший значение
+	// из хранилища, кладёт его через SetIfGen, чтобы не вернуть в кэш
+	// запись, удалённую, пока шёл запрос в БД.
+	gen uint64
 }
 
 func NewURLCache(max int) *URLCache {
@@ -28,30 +41,55 @@ func NewURLCache(max int) *URLCache {
 	}
 }
 
-func (c *URLCache) Get(code string) (string, bool) {
+// Get возвращает редирект по коду. Просроченная запись считается промахом и удаляется.
+func (c *URLCache) Get(code string) (domain.Redirect, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if ele, ok := c.cache[code]; ok {
-		c.ll.MoveToFront(ele)
 		ent := ele.Value.(*entry)
+		if ent.expired(time.Now()) {
+			c.removeElement(ele)
+			return domain.Redirect{}, false
+		}
+		c.ll.MoveToFront(ele)
 		return ent.value, true
 	}
-	return "", false
+	return domain.Redirect{}, false
 }
 
-func (c *URLCache) Set(code, url string) {
+// Contains сообщает, есть ли в кэше непросроченная запись, не меняя порядок вытеснения.
+func (c *URLCache) Contains(code string) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	ele, ok := c.cache[code]
+	return ok && !ele.Value.(*entry).expired(time.Now())
+}
+
+// Set кладёт редирект в кэш. expiresAt == nil — запись живёт, пока её не вытеснят.
+func (c *URLCache) Set(code string, r domain.Redirect, expiresAt *time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(code, r, expiresAt)
+}
+
+func (c *URLCache) set(code string, r domain.Redirect, expiresAt *time.Time) {
+	var deadline time.Time
+	if expiresAt != nil {
+		deadline = *expiresAt
+	}
+
 	if ele, ok := c.cache[code]; ok {
 		c.ll.MoveToFront(ele)
 		ent := ele.Value.(*entry)
-		ent.value = url
+		ent.value = r
+		ent.deadline = deadline
 		return
 	}
 
-	ele := c.ll.PushFront(&entry{key: code, value: url})
+	ele := c.ll.PushFront(&entry{key: code, value: r, deadline: deadline})
 	c.cache[code] = ele
 
 	if c.ll.Len() > c.max {
@@ -59,11 +97,45 @@ func (c *URLCache) Set(code, url string) {
 	}
 }
 
+// Generation возвращает текущее поколение инвалидаций (см. SetIfGen).
+func (c *URLCache) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// SetIfGen работает как Set, но только если с момента получения gen не было инвалидаций.
+func (c *URLCache) SetIfGen(code string, r domain.Redirect, expiresAt *time.Time, gen uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.gen != gen {
+		return false
+	}
+	c.set(code, r, expiresAt)
+	return true
+}
+
+// Delete удаляет код из кэша и начинает новое поколение инвалидаций.
+func (c *URLCache) Delete(code string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if ele, ok := c.cache[code]; ok {
+		c.removeElement(ele)
+	}
+}
+
 func (c *URLCache) removeOldest() {
 	ele := c.ll.Back()
 	if ele == nil {
 		return
 	}
+	c.removeElement(ele)
+}
+
+func (c *URLCache) removeElement(ele *list.Element) {
 	c.ll.Remove(ele)
 	ent := ele.Value.(*entry)
 	delete(c.cache, ent.key)
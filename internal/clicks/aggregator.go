@@ -0,0 +1,107 @@
+package clicks
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"shortener/internal/domain"
+)
+
+// Store — хранилище, в которое сбрасываются накопленные клики.
+type Store interface {
+	IncrementClicks(ctx context.Context, deltas map[string]int64) error
+}
+
+// Aggregator копит клики в памяти по кодам и периодически сбрасывает
+// приращения в хранилище одним пакетом. Add не ходит в БД и не блокирует редирект.
+type Aggregator struct {
+	store    Store
+	logger   *slog.Logger
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[string]int64
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewAggregator(store Store, interval time.Duration, logger *slog.Logger) *Aggregator {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	return &Aggregator{
+		store:    store,
+		logger:   logger,
+		interval: interval,
+		pending:  make(map[string]int64),
+		done:     make(chan struct{}),
+	}
+}
+
+var _ Sink = (*Aggregator)(nil)
+
+// Consume учитывает один переход по коду.
+func (a *Aggregator) Consume(ev domain.ClickEvent) {
+	a.mu.Lock()
+	a.pending[ev.Code]++
+	a.mu.Unlock()
+}
+
+// Start запускает периодический сброс в фоне.
+func (a *Aggregator) Start() {
+	a.wg.Add(1)
+	go a.loop()
+}
+
+func (a *Aggregator) loop() {
+	defer a.wg.Done()
+
+	t := time.NewTicker(a.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			ctx, cancel := context.WithTimeout(context.Background(), a.interval)
+			if err := a.Flush(ctx); err != nil {
+				a.logger.Error("flush clicks", "err", err)
+			}
+			cancel()
+		case <-a.done:
+			return
+		}
+	}
+}
+
+// Flush сбрасывает накопленное. При ошибке приращения возвращаются в буфер
+// и будут отправлены при следующем сбросе.
+func (a *Aggregator) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	if len(a.pending) == 0 {
+		a.mu.Unlock()
+		return nil
+	}
+	batch := a.pending
+	a.pending = make(map[string]int64, len(batch))
+	a.mu.Unlock()
+
+	if err := a.store.IncrementClicks(ctx, batch); err != nil {
+		a.mu.Lock()
+		for code, n := range batch {
+			a.pending[code] += n
+		}
+		a.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close останавливает фоновый сброс и сбрасывает остаток.
+func (a *Aggregator) Close(ctx context.Context) error {
+	close(a.done)
+	a.wg.Wait()
+	return a.Flush(ctx)
+}
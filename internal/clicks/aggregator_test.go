@@ -0,0 +1,72 @@
+package clicks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"shortener/internal/domain"
+	"shortener/internal/logger"
+	"shortener/internal/repo/memory"
+)
+
+type failingStore struct {
+	fail  bool
+	calls []map[string]int64
+}
+
+func (s *failingStore) IncrementClicks(_ context.Context, deltas map[string]int64) error {
+	if s.fail {
+		return errors.New("db is down")
+	}
+	s.calls = append(s.calls, deltas)
+	return nil
+}
+
+func TestAggregatorFlushesToRepo(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.New()
+	if err := repo.Create(ctx, "abc", "https://example.com", nil, 0); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	agg := NewAggregator(repo, time.Hour, logger.NewNoopLogger())
+	for i := 0; i < 3; i++ {
+		agg.Consume(domain.ClickEvent{Code: "abc"})
+	}
+	agg.Consume(domain.ClickEvent{Code: "missing"})
+
+	if err := agg.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	u, err := repo.GetByCode(ctx, "abc")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if u.ClickCount != 3 {
+		t.Fatalf("click_count = %d, want 3", u.ClickCount)
+	}
+}
+
+func TestAggregatorKeepsClicksOnFailure(t *testing.T) {
+	ctx := context.Background()
+	store := &failingStore{fail: true}
+	agg := NewAggregator(store, time.Hour, logger.NewNoopLogger())
+
+	agg.Consume(domain.ClickEvent{Code: "abc"})
+	if err := agg.Flush(ctx); err == nil {
+		t.Fatalf("flush: want error")
+	}
+
+	agg.Consume(domain.ClickEvent{Code: "abc"})
+	store.fail = false
+	if err := agg.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if len(store.calls) != 1 || store.calls[0]["abc"] != 2 {
+		t.Fatalf("calls = %v, want one batch with abc=2", store.calls)
+	}
+}
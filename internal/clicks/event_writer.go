@@ -0,0 +1,123 @@
+package clicks
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"shortener/internal/domain"
+)
+
+// EventStore — хранилище сырых событий переходов для аналитики.
+type EventStore interface {
+	SaveClicks(ctx context.Context, events []domain.ClickEvent) error
+}
+
+// EventWriter буферизует события и пишет их в EventStore пачками:
+// по таймеру или при накоплении batchSize событий.
+type EventWriter struct {
+	store     EventStore
+	logger    *slog.Logger
+	interval  time.Duration
+	batchSize int
+
+	mu  sync.Mutex
+	buf []domain.ClickEvent
+
+	kick chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+var _ Sink = (*EventWriter)(nil)
+
+func NewEventWriter(store EventStore, interval time.Duration, batchSize int, logger *slog.Logger) *EventWriter {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	return &EventWriter{
+		store:     store,
+		logger:    logger,
+		interval:  interval,
+		batchSize: batchSize,
+		kick:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+}
+
+func (w *EventWriter) Consume(ev domain.ClickEvent) {
+	w.mu.Lock()
+	w.buf = append(w.buf, ev)
+	full := len(w.buf) >= w.batchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Start запускает фоновую запись.
+func (w *EventWriter) Start() {
+	w.wg.Add(1)
+	go w.loop()
+}
+
+func (w *EventWriter) loop() {
+	defer w.wg.Done()
+
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-w.kick:
+		case <-w.done:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), w.interval)
+		if err := w.Flush(ctx); err != nil {
+			w.logger.Error("flush click events", "err", err)
+		}
+		cancel()
+	}
+}
+
+// Flush записывает буфер. При ошибке события возвращаются в начало буфера.
+func (w *EventWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	batch := w.buf
+	w.buf = nil
+	w.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if err := w.store.SaveClicks(ctx, batch); err != nil {
+		w.mu.Lock()
+		w.buf = append(batch, w.buf...)
+		// хранилище долго недоступно — не даём буферу расти бесконечно, старые события отбрасываем
+		if limit := 10 * w.batchSize; len(w.buf) > limit {
+			w.buf = w.buf[len(w.buf)-limit:]
+		}
+		w.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close останавливает фоновую запись и сбрасывает остаток.
+func (w *EventWriter) Close(ctx context.Context) error {
+	close(w.done)
+	w.wg.Wait()
+	return w.Flush(ctx)
+}
@@ -0,0 +1,171 @@
+package clicks
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"shortener/internal/domain"
+)
+
+// Sink — получатель событий переходов. Consume вызывается из нескольких
+// воркеров одновременно. Close вызывается один раз при остановке конвейера,
+// после того как все события доставлены, и должен сбросить накопленное.
+type Sink interface {
+	Consume(ev domain.ClickEvent)
+	Close(ctx context.Context) error
+}
+
+// OverflowPolicy определяет поведение Record при заполненной очереди.
+type OverflowPolicy int
+
+const (
+	// DropOnOverflow отбрасывает событие и увеличивает счётчик потерь.
+	DropOnOverflow OverflowPolicy = iota
+	// BlockOnOverflow ждёт место в очереди не дольше BlockTimeout, затем отбрасывает.
+	BlockOnOverflow
+)
+
+type PipelineConfig struct {
+	QueueSize    int
+	Workers      int
+	Overflow     OverflowPolicy
+	BlockTimeout time.Duration
+}
+
+// PipelineStats — метрики конвейера.
+type PipelineStats struct {
+	QueueLen  int   `json:"queue_len"`
+	QueueCap  int   `json:"queue_cap"`
+	Accepted  int64 `json:"accepted"`
+	Dropped   int64 `json:"dropped"`
+	Delivered int64 `json:"delivered"`
+}
+
+// Pipeline доставляет события переходов в Sink'и через ограниченную очередь
+// и фиксированный пул воркеров, вместо горутины на каждый запрос.
+type Pipeline struct {
+	cfg    PipelineConfig
+	sinks  []Sink
+	logger *slog.Logger
+
+	ch chan domain.ClickEvent
+
+	// mu защищает закрытие канала: Record держит RLock на время отправки.
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+
+	accepted  atomic.Int64
+	dropped   atomic.Int64
+	delivered atomic.Int64
+}
+
+func NewPipeline(cfg PipelineConfig, logger *slog.Logger, sinks ...Sink) *Pipeline {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 10_000
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.BlockTimeout <= 0 {
+		cfg.BlockTimeout = 5 * time.Millisecond
+	}
+
+	p := &Pipeline{
+		cfg:    cfg,
+		sinks:  sinks,
+		logger: logger,
+		ch:     make(chan domain.ClickEvent, cfg.QueueSize),
+	}
+	p.wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+func (p *Pipeline) worker() {
+	defer p.wg.Done()
+	for ev := range p.ch {
+		for _, s := range p.sinks {
+			s.Consume(ev)
+		}
+		p.delivered.Add(1)
+	}
+}
+
+// Record ставит событие в очередь согласно политике переполнения.
+// После Close события молча отбрасываются.
+func (p *Pipeline) Record(ev domain.ClickEvent) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		p.dropped.Add(1)
+		return
+	}
+
+	select {
+	case p.ch <- ev:
+		p.accepted.Add(1)
+		return
+	default:
+	}
+
+	if p.cfg.Overflow == BlockOnOverflow {
+		t := time.NewTimer(p.cfg.BlockTimeout)
+		defer t.Stop()
+		select {
+		case p.ch <- ev:
+			p.accepted.Add(1)
+			return
+		case <-t.C:
+		}
+	}
+	p.dropped.Add(1)
+}
+
+func (p *Pipeline) Stats() PipelineStats {
+	return PipelineStats{
+		QueueLen:  len(p.ch),
+		QueueCap:  cap(p.ch),
+		Accepted:  p.accepted.Load(),
+		Dropped:   p.dropped.Load(),
+		Delivered: p.delivered.Load(),
+	}
+}
+
+// Close перестаёт принимать события, дожидается обработки очереди и закрывает Sink'и.
+func (p *Pipeline) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.ch)
+	p.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		p.logger.Warn("click pipeline: shutdown before queue drained", "left", len(p.ch))
+	}
+
+	var errs []error
+	for _, s := range p.sinks {
+		if err := s.Close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,110 @@
+package clicks
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"shortener/internal/domain"
+	"shortener/internal/logger"
+)
+
+// gatedSink не обрабатывает события, пока не открыт gate.
+type gatedSink struct {
+	gate   chan struct{}
+	mu     sync.Mutex
+	got    int
+	closed bool
+}
+
+func (s *gatedSink) Consume(domain.ClickEvent) {
+	<-s.gate
+	s.mu.Lock()
+	s.got++
+	s.mu.Unlock()
+}
+
+func (s *gatedSink) Close(context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	return nil
+}
+
+func TestPipelineDropsOnOverflow(t *testing.T) {
+	sink := &gatedSink{gate: make(chan struct{})}
+	p := NewPipeline(PipelineConfig{QueueSize: 2, Workers: 1}, logger.NewNoopLogger(), sink)
+
+	// одно событие забирает воркер, два лежат в очереди, остальные отбрасываются
+	p.Record(domain.ClickEvent{Code: "abc"})
+	waitQueueEmpty(t, p)
+	for i := 0; i < 9; i++ {
+		p.Record(domain.ClickEvent{Code: "abc"})
+	}
+
+	st := p.Stats()
+	if st.Accepted != 3 || st.Dropped != 7 {
+		t.Fatalf("stats = %+v, want accepted=3 dropped=7", st)
+	}
+
+	close(sink.gate)
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if sink.got != 3 || !sink.closed {
+		t.Fatalf("sink got=%d closed=%v, want 3 and closed", sink.got, sink.closed)
+	}
+
+	p.Record(domain.ClickEvent{Code: "abc"})
+	if st := p.Stats(); st.Dropped != 8 {
+		t.Fatalf("record after close: dropped = %d, want 8", st.Dropped)
+	}
+}
+
+func TestPipelineBlocksWithTimeout(t *testing.T) {
+	sink := &gatedSink{gate: make(chan struct{})}
+	p := NewPipeline(PipelineConfig{
+		QueueSize:    1,
+		Workers:      1,
+		Overflow:     BlockOnOverflow,
+		BlockTimeout: 20 * time.Millisecond,
+	}, logger.NewNoopLogger(), sink)
+
+	p.Record(domain.ClickEvent{Code: "abc"})
+	waitQueueEmpty(t, p)
+	p.Record(domain.ClickEvent{Code: "abc"})
+
+	// очередь полна: ждём таймаут и отбрасываем
+	start := time.Now()
+	p.Record(domain.ClickEvent{Code: "abc"})
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Fatalf("record returned after %s, want to block ~20ms", d)
+	}
+
+	// место освобождается во время ожидания — событие принимается
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		close(sink.gate)
+	}()
+	p.Record(domain.ClickEvent{Code: "abc"})
+
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if st := p.Stats(); st.Accepted != 3 || st.Dropped != 1 || st.Delivered != 3 {
+		t.Fatalf("stats = %+v, want accepted=3 dropped=1 delivered=3", st)
+	}
+}
+
+// waitQueueEmpty ждёт, пока воркер заберёт события из очереди.
+func waitQueueEmpty(t *testing.T, p *Pipeline) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for p.Stats().QueueLen > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue was not drained")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,143 @@
+package clicks
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"shortener/internal/domain"
+	"shortener/internal/hll"
+)
+
+// SketchStore — хранилище дневных HyperLogLog-скетчей.
+type SketchStore interface {
+	MergeSketches(ctx context.Context, sketches []domain.DailySketch) error
+}
+
+type dayKey struct {
+	code string
+	day  int64
+}
+
+// UniqueTracker считает уникальных посетителей по Visitor.Fingerprint в дневных
+// HyperLogLog-скетчах и периодически объединяет их с сохранёнными в хранилище.
+// В памяти держится только приращение с последнего сброса.
+type UniqueTracker struct {
+	store    SketchStore
+	logger   *slog.Logger
+	interval time.Duration
+
+	mu       sync.Mutex
+	sketches map[dayKey]*hll.Sketch
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+var _ Sink = (*UniqueTracker)(nil)
+
+func NewUniqueTracker(store SketchStore, interval time.Duration, logger *slog.Logger) *UniqueTracker {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	return &UniqueTracker{
+		store:    store,
+		logger:   logger,
+		interval: interval,
+		sketches: make(map[dayKey]*hll.Sketch),
+		done:     make(chan struct{}),
+	}
+}
+
+func (u *UniqueTracker) Consume(ev domain.ClickEvent) {
+	// Fingerprint — hex SHA-256, его префикс уже равномерно распределён
+	if len(ev.Fingerprint) < 16 {
+		return
+	}
+	h, err := strconv.ParseUint(ev.Fingerprint[:16], 16, 64)
+	if err != nil {
+		return
+	}
+
+	sec := ev.At.Unix()
+	key := dayKey{code: ev.Code, day: sec - sec%86400}
+
+	u.mu.Lock()
+	sk, ok := u.sketches[key]
+	if !ok {
+		sk = hll.New(hll.DefaultPrecision)
+		u.sketches[key] = sk
+	}
+	sk.Add(h)
+	u.mu.Unlock()
+}
+
+// Start запускает периодический сброс в фоне.
+func (u *UniqueTracker) Start() {
+	u.wg.Add(1)
+	go u.loop()
+}
+
+func (u *UniqueTracker) loop() {
+	defer u.wg.Done()
+
+	t := time.NewTicker(u.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			ctx, cancel := context.WithTimeout(context.Background(), u.interval)
+			if err := u.Flush(ctx); err != nil {
+				u.logger.Error("flush unique sketches", "err", err)
+			}
+			cancel()
+		case <-u.done:
+			return
+		}
+	}
+}
+
+// Flush объединяет накопленные скетчи с хранилищем. При ошибке они
+// возвращаются в память и будут отправлены при следующем сбросе.
+func (u *UniqueTracker) Flush(ctx context.Context) error {
+	u.mu.Lock()
+	if len(u.sketches) == 0 {
+		u.mu.Unlock()
+		return nil
+	}
+	batch := u.sketches
+	u.sketches = make(map[dayKey]*hll.Sketch, len(batch))
+	u.mu.Unlock()
+
+	out := make([]domain.DailySketch, 0, len(batch))
+	for key, sk := range batch {
+		data, err := sk.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		out = append(out, domain.DailySketch{Code: key.code, Day: time.Unix(key.day, 0).UTC(), Sketch: data})
+	}
+
+	if err := u.store.MergeSketches(ctx, out); err != nil {
+		u.mu.Lock()
+		for key, sk := range batch {
+			if cur, ok := u.sketches[key]; ok {
+				_ = sk.Merge(cur)
+			}
+			u.sketches[key] = sk
+		}
+		u.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close останавливает фоновый сброс и сбрасывает остаток.
+func (u *UniqueTracker) Close(ctx context.Context) error {
+	close(u.done)
+	u.wg.Wait()
+	return u.Flush(ctx)
+}
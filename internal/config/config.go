@@ -1,30 +1,162 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+)
+
+// Поддерживаемые хранилища ссылок.
+const (
+	StorageMemory = "memory"
+	StorageSQLite = "sqlite"
+)
+
+// Способы генерации коротких кодов.
+const (
+	CodeStrategyRandom    = "random"
+	CodeStrategyFeistel   = "feistel"
+	CodeStrategySnowflake = "snowflake"
+	CodeStrategyHash      = "hash"
+)
+
+// Алфавиты коротких кодов.
+const (
+	CodeAlphabetBase64URL = "base64url"
+	CodeAlphabetCrockford = "crockford"
+)
+
+// Политики переполнения очереди кликов.
+const (
+	ClickOverflowDrop  = "drop"
+	ClickOverflowBlock = "block"
 )
 
 type Config struct {
 	ServerPort string
 	DBPath     string
-	BaseURL    string
+	Storage    string
+
+	// AdminAddr — адрес отдельного служебного листенера с /debug/vars
+	// (например, 127.0.0.1:8385). Пусто — метрики не публикуются.
+	AdminAddr string
+
+	// BaseURL — публичный адрес, от которого строятся short_url. Пусто —
+	// адрес берётся из запроса: Host и TLS, а от доверенных прокси
+	// (TrustedProxies) — X-Forwarded-Proto/X-Forwarded-Host.
+	BaseURL string
+
+	// CodeStrategy — способ генерации кодов. Для snowflake у каждого экземпляра,
+	// работающего с общим хранилищем, должен быть свой NodeID (0..1023),
+	// для feistel нужен постоянный секретный CodeKey. CodeLength — начальная
+	// длина кодов random и hash; при частых коллизиях она растёт до CodeMaxLength
+	// (0 — длина не растёт).
+	CodeStrategy  string
+	CodeLength    int
+	CodeMaxLength int
+	CodeKey       string
+	NodeID        int64
+
+	// CodeAlphabet — алфавит кодов; crockford не путает 0/O, 1/l/I и не
+	// зависит от регистра. CodeCheckChar добавляет контрольный символ, чтобы
+	// отличать опечатки от неизвестных кодов (только для crockford).
+	CodeAlphabet  string
+	CodeCheckChar bool
+
+	// CodeBlocklistPath — файл со словами, которые не должны встречаться в
+	// сгенерированных кодах (по слову в строке). Пусто — без фильтра.
+	CodeBlocklistPath string
+
+	// URLSchemes — допустимые схемы адресов назначения, MaxURLLength — их
+	// максимальная длина в байтах.
+	URLSchemes   []string
+	MaxURLLength int
+
+	// AliasDomains — другие домены, на которых доступен сокращатель (кроме
+	// хоста BaseURL и хоста, на который пришёл запрос). Ссылки на свои домены
+	// запрещены; SelfLinkDepth > 0 разрешает их, если цепочка ссылок не
+	// длиннее SelfLinkDepth и без циклов.
+	AliasDomains  []string
+	SelfLinkDepth int
+
+	// PolicyPath — файл правил для адресов назначения (internal/policy),
+	// перечитывается по SIGHUP. Пусто — только встроенные правила,
+	// запрещающие частные и loopback-адреса.
+	PolicyPath string
+
+	// RedirectStatus — статус редиректа для ссылок, созданных без явного
+	// redirect_status (301, 302, 307 или 308). Ссылки со сроком жизни вместо
+	// постоянного редиректа получают 302.
+	RedirectStatus int
+
+	// MaxTTL — максимальный срок жизни ссылки, 0 — без ограничений.
+	MaxTTL time.Duration
+
+	// ClickFlushInterval — как часто накопленные клики сбрасываются в хранилище.
+	ClickFlushInterval time.Duration
+
+	// Очередь событий переходов: размер, число воркеров и поведение при переполнении.
+	ClickQueueSize    int
+	ClickWorkers      int
+	ClickOverflow     string // drop|block
+	ClickBlockTimeout time.Duration
+
+	// Dedup — для уже сокращённого адреса возвращать существующую ссылку.
+	Dedup bool
+
+	// AsyncCreate включает write-behind: ответ на создание до записи в БД,
+	// с журналом (каталог сегментов JournalPath) для восстановления.
+	AsyncCreate bool
+	JournalPath string
+
+	// IPHashSalt — соль для хэширования IP в аналитике. Пусто — случайная,
+	// созданная при первом запуске и сохранённая в хранилище аналитики.
+	IPHashSalt string
+
+	// TrustedProxies — CIDR-подсети прокси, которым разрешено передавать
+	// X-Forwarded-Proto/X-Forwarded-Host. Пусто — заголовки игнорируются,
+	// как и при заданном BaseURL.
+	TrustedProxies []string
 }
 
 // LoadConfig загружает конфиг в порядке приоритета:
 // 1. Значения по умолчанию
 // 2. Переменные окружения
 // 3. Флаги командной строки (наивысший приоритет)
-func LoadConfig() *Config {
+//
+// Некорректное значение — ошибка, а не тихий возврат к значению по умолчанию.
+func LoadConfig() (*Config, error) {
 	// 1. Значения по умолчанию
 	cfg := &Config{
 		ServerPort: "8384",
 		DBPath:     "./data/shortener.db",
-		BaseURL:    "http://localhost:8384",
+		Storage:    StorageMemory,
+		MaxTTL:     365 * 24 * time.Hour,
+
+		RedirectStatus: 301,
+
+		CodeStrategy:  CodeStrategyRandom,
+		CodeLength:    8,
+		CodeMaxLength: 12,
+		CodeAlphabet:  CodeAlphabetBase64URL,
+
+		URLSchemes:   []string{"http", "https"},
+		MaxURLLength: 2048,
+
+		ClickFlushInterval: 5 * time.Second,
+		ClickQueueSize:     10_000,
+		ClickWorkers:       2,
+		ClickOverflow:      ClickOverflowDrop,
+		ClickBlockTimeout:  5 * time.Millisecond,
+		JournalPath:        "./data/journal",
 	}
 
 	// 2. Переменные окружения
+	var errs []error
 	if v := os.Getenv("SHORTENER_SERVER_PORT"); v != "" {
 		cfg.ServerPort = v
 	}
@@ -34,12 +166,120 @@ func LoadConfig() *Config {
 	if v := os.Getenv("SHORTENER_BASE_URL"); v != "" {
 		cfg.BaseURL = v
 	}
+	if v := os.Getenv("SHORTENER_STORAGE"); v != "" {
+		cfg.Storage = v
+	}
+	if v := os.Getenv("SHORTENER_ADMIN_ADDR"); v != "" {
+		cfg.AdminAddr = v
+	}
+	if v := os.Getenv("SHORTENER_MAX_TTL"); v != "" {
+		errs = append(errs, parseDuration(&cfg.MaxTTL, "SHORTENER_MAX_TTL", v))
+	}
+	if v := os.Getenv("SHORTENER_REDIRECT_STATUS"); v != "" {
+		errs = append(errs, parseInt(&cfg.RedirectStatus, "SHORTENER_REDIRECT_STATUS", v, 1))
+	}
+	if v := os.Getenv("SHORTENER_CLICK_FLUSH_INTERVAL"); v != "" {
+		errs = append(errs, parseDuration(&cfg.ClickFlushInterval, "SHORTENER_CLICK_FLUSH_INTERVAL", v))
+	}
+	if v := os.Getenv("SHORTENER_CLICK_QUEUE_SIZE"); v != "" {
+		errs = append(errs, parseInt(&cfg.ClickQueueSize, "SHORTENER_CLICK_QUEUE_SIZE", v, 1))
+	}
+	if v := os.Getenv("SHORTENER_CLICK_WORKERS"); v != "" {
+		errs = append(errs, parseInt(&cfg.ClickWorkers, "SHORTENER_CLICK_WORKERS", v, 1))
+	}
+	if v := os.Getenv("SHORTENER_CLICK_OVERFLOW"); v != "" {
+		cfg.ClickOverflow = v
+	}
+	if v := os.Getenv("SHORTENER_CLICK_BLOCK_TIMEOUT"); v != "" {
+		errs = append(errs, parseDuration(&cfg.ClickBlockTimeout, "SHORTENER_CLICK_BLOCK_TIMEOUT", v))
+	}
+	if v := os.Getenv("SHORTENER_ASYNC_CREATE"); v != "" {
+		errs = append(errs, parseBool(&cfg.AsyncCreate, "SHORTENER_ASYNC_CREATE", v))
+	}
+	if v := os.Getenv("SHORTENER_CODE_STRATEGY"); v != "" {
+		cfg.CodeStrategy = v
+	}
+	if v := os.Getenv("SHORTENER_CODE_LENGTH"); v != "" {
+		errs = append(errs, parseInt(&cfg.CodeLength, "SHORTENER_CODE_LENGTH", v, 1))
+	}
+	if v := os.Getenv("SHORTENER_CODE_MAX_LENGTH"); v != "" {
+		errs = append(errs, parseInt(&cfg.CodeMaxLength, "SHORTENER_CODE_MAX_LENGTH", v, 0))
+	}
+	if v := os.Getenv("SHORTENER_CODE_KEY"); v != "" {
+		cfg.CodeKey = v
+	}
+	if v := os.Getenv("SHORTENER_CODE_ALPHABET"); v != "" {
+		cfg.CodeAlphabet = v
+	}
+	if v := os.Getenv("SHORTENER_CODE_CHECK_CHAR"); v != "" {
+		errs = append(errs, parseBool(&cfg.CodeCheckChar, "SHORTENER_CODE_CHECK_CHAR", v))
+	}
+	if v := os.Getenv("SHORTENER_CODE_BLOCKLIST"); v != "" {
+		cfg.CodeBlocklistPath = v
+	}
+	if v := os.Getenv("SHORTENER_NODE_ID"); v != "" {
+		errs = append(errs, parseNodeID(&cfg.NodeID, "SHORTENER_NODE_ID", v))
+	}
+	if v := os.Getenv("SHORTENER_URL_SCHEMES"); v != "" {
+		cfg.URLSchemes = splitList(v)
+	}
+	if v := os.Getenv("SHORTENER_MAX_URL_LENGTH"); v != "" {
+		errs = append(errs, parseInt(&cfg.MaxURLLength, "SHORTENER_MAX_URL_LENGTH", v, 1))
+	}
+	if v := os.Getenv("SHORTENER_ALIAS_DOMAINS"); v != "" {
+		cfg.AliasDomains = splitList(v)
+	}
+	if v := os.Getenv("SHORTENER_SELF_LINK_DEPTH"); v != "" {
+		errs = append(errs, parseInt(&cfg.SelfLinkDepth, "SHORTENER_SELF_LINK_DEPTH", v, 0))
+	}
+	if v := os.Getenv("SHORTENER_POLICY_PATH"); v != "" {
+		cfg.PolicyPath = v
+	}
+	if v := os.Getenv("SHORTENER_DEDUP"); v != "" {
+		errs = append(errs, parseBool(&cfg.Dedup, "SHORTENER_DEDUP", v))
+	}
+	if v := os.Getenv("SHORTENER_JOURNAL_PATH"); v != "" {
+		cfg.JournalPath = v
+	}
+	if v := os.Getenv("SHORTENER_IP_HASH_SALT"); v != "" {
+		cfg.IPHashSalt = v
+	}
+	if v := os.Getenv("SHORTENER_TRUSTED_PROXIES"); v != "" {
+		cfg.TrustedProxies = splitList(v)
+	}
 
 	// 3. Флаги командной строки
 	var (
 		flagPort    = flag.String("port", "", "Server port (e.g. 8384)")
 		flagDBPath  = flag.String("db-path", "", "Path to SQLite database file")
-		flagBaseURL = flag.String("base-url", "", "Base URL for generated short links")
+		flagBaseURL = flag.String("base-url", "", "Public base URL for generated short links; empty derives it from the request")
+		flagStorage = flag.String("storage", "", "Storage backend: memory|sqlite")
+		flagAdmin   = flag.String("admin-addr", "", "Separate listen address for /debug/vars (e.g. 127.0.0.1:8385), empty disables it")
+		flagMaxTTL  = flag.String("max-ttl", "", "Max link lifetime (e.g. 720h), 0 disables the limit")
+		flagRedirct = flag.String("redirect-status", "", "Default redirect status for new links: 301|302|307|308")
+		flagFlush   = flag.String("click-flush-interval", "", "How often click counters are flushed to storage (e.g. 5s)")
+		flagQueue   = flag.String("click-queue-size", "", "Capacity of the click event queue")
+		flagWorkers = flag.String("click-workers", "", "Number of click event workers")
+		flagOverflw = flag.String("click-overflow", "", "Click queue overflow policy: drop|block")
+		flagBlockTO = flag.String("click-block-timeout", "", "Max wait for queue space with -click-overflow=block")
+		flagCodeGen = flag.String("code-strategy", "", "Short code generation: random|feistel|snowflake|hash")
+		flagCodeLen = flag.String("code-length", "", "Length of random and hash codes")
+		flagCodeMax = flag.String("code-max-length", "", "Max length random and hash codes may grow to when collisions become frequent, 0 disables growth")
+		flagCodeKey = flag.String("code-key", "", "Secret key for feistel codes, must stay the same across restarts")
+		flagCodeAlp = flag.String("code-alphabet", "", "Alphabet for generated codes: base64url|crockford")
+		flagCodeChk = flag.String("code-check-char", "", "Append a check character to generated codes (true|false, crockford only)")
+		flagCodeBlk = flag.String("code-blocklist", "", "File with words that must not appear in generated codes")
+		flagNodeID  = flag.String("node-id", "", "Node ID embedded in snowflake codes, unique per instance (0-1023)")
+		flagSchemes = flag.String("url-schemes", "", "Comma-separated URL schemes allowed as redirect targets")
+		flagURLMax  = flag.String("max-url-length", "", "Max length of a URL to shorten, in bytes")
+		flagAliases = flag.String("alias-domains", "", "Comma-separated extra domains serving short links, besides the base URL host")
+		flagSelfDep = flag.String("self-link-depth", "", "Allow links to own short links if the chain ends within this many hops, 0 forbids them")
+		flagPolicy  = flag.String("policy", "", "File with allow/deny rules for destination hosts, reloaded on SIGHUP")
+		flagDedup   = flag.String("dedup", "", "Return the existing short link for an already shortened URL (true|false)")
+		flagAsync   = flag.String("async-create", "", "Answer shorten requests before the DB write (true|false)")
+		flagJournal = flag.String("journal-path", "", "Directory for write-behind journal segments")
+		flagIPSalt  = flag.String("ip-hash-salt", "", "Salt for hashing client IPs in click analytics")
+		flagProxies = flag.String("trusted-proxies", "", "Comma-separated CIDRs allowed to set X-Forwarded-* headers")
 	)
 
 	flag.Parse()
@@ -53,11 +293,150 @@ func LoadConfig() *Config {
 	if *flagBaseURL != "" {
 		cfg.BaseURL = *flagBaseURL
 	}
+	if *flagStorage != "" {
+		cfg.Storage = *flagStorage
+	}
+	if *flagAdmin != "" {
+		cfg.AdminAddr = *flagAdmin
+	}
+	if *flagMaxTTL != "" {
+		errs = append(errs, parseDuration(&cfg.MaxTTL, "-max-ttl", *flagMaxTTL))
+	}
+	if *flagRedirct != "" {
+		errs = append(errs, parseInt(&cfg.RedirectStatus, "-redirect-status", *flagRedirct, 1))
+	}
+	if *flagFlush != "" {
+		errs = append(errs, parseDuration(&cfg.ClickFlushInterval, "-click-flush-interval", *flagFlush))
+	}
+	if *flagQueue != "" {
+		errs = append(errs, parseInt(&cfg.ClickQueueSize, "-click-queue-size", *flagQueue, 1))
+	}
+	if *flagWorkers != "" {
+		errs = append(errs, parseInt(&cfg.ClickWorkers, "-click-workers", *flagWorkers, 1))
+	}
+	if *flagOverflw != "" {
+		cfg.ClickOverflow = *flagOverflw
+	}
+	if *flagBlockTO != "" {
+		errs = append(errs, parseDuration(&cfg.ClickBlockTimeout, "-click-block-timeout", *flagBlockTO))
+	}
+	if *flagCodeGen != "" {
+		cfg.CodeStrategy = *flagCodeGen
+	}
+	if *flagCodeLen != "" {
+		errs = append(errs, parseInt(&cfg.CodeLength, "-code-length", *flagCodeLen, 1))
+	}
+	if *flagCodeMax != "" {
+		errs = append(errs, parseInt(&cfg.CodeMaxLength, "-code-max-length", *flagCodeMax, 0))
+	}
+	if *flagCodeKey != "" {
+		cfg.CodeKey = *flagCodeKey
+	}
+	if *flagCodeAlp != "" {
+		cfg.CodeAlphabet = *flagCodeAlp
+	}
+	if *flagCodeChk != "" {
+		errs = append(errs, parseBool(&cfg.CodeCheckChar, "-code-check-char", *flagCodeChk))
+	}
+	if *flagCodeBlk != "" {
+		cfg.CodeBlocklistPath = *flagCodeBlk
+	}
+	if *flagNodeID != "" {
+		errs = append(errs, parseNodeID(&cfg.NodeID, "-node-id", *flagNodeID))
+	}
+	if *flagSchemes != "" {
+		cfg.URLSchemes = splitList(*flagSchemes)
+	}
+	if *flagURLMax != "" {
+		errs = append(errs, parseInt(&cfg.MaxURLLength, "-max-url-length", *flagURLMax, 1))
+	}
+	if *flagAliases != "" {
+		cfg.AliasDomains = splitList(*flagAliases)
+	}
+	if *flagSelfDep != "" {
+		errs = append(errs, parseInt(&cfg.SelfLinkDepth, "-self-link-depth", *flagSelfDep, 0))
+	}
+	if *flagPolicy != "" {
+		cfg.PolicyPath = *flagPolicy
+	}
+	if *flagDedup != "" {
+		errs = append(errs, parseBool(&cfg.Dedup, "-dedup", *flagDedup))
+	}
+	if *flagAsync != "" {
+		errs = append(errs, parseBool(&cfg.AsyncCreate, "-async-create", *flagAsync))
+	}
+	if *flagJournal != "" {
+		cfg.JournalPath = *flagJournal
+	}
+	if *flagIPSalt != "" {
+		cfg.IPHashSalt = *flagIPSalt
+	}
+	if *flagProxies != "" {
+		cfg.TrustedProxies = splitList(*flagProxies)
+	}
 
 	// Приведение порта к формату ":8384"
 	if !strings.HasPrefix(cfg.ServerPort, ":") {
 		cfg.ServerPort = ":" + cfg.ServerPort
 	}
+	cfg.Storage = strings.ToLower(strings.TrimSpace(cfg.Storage))
+	cfg.CodeStrategy = strings.ToLower(strings.TrimSpace(cfg.CodeStrategy))
+	cfg.CodeAlphabet = strings.ToLower(strings.TrimSpace(cfg.CodeAlphabet))
+	cfg.ClickOverflow = strings.ToLower(strings.TrimSpace(cfg.ClickOverflow))
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// parseInt разбирает целое не меньше min.
+func parseInt(dst *int, name, v string, min int) error {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min {
+		return fmt.Errorf("invalid %s=%q: want an integer >= %d", name, v, min)
+	}
+	*dst = n
+	return nil
+}
+
+// parseNodeID разбирает номер узла; диапазон проверяется при создании генератора.
+func parseNodeID(dst *int64, name, v string) error {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid %s=%q: want a non-negative integer", name, v)
+	}
+	*dst = n
+	return nil
+}
+
+// parseBool разбирает логическое значение.
+func parseBool(dst *bool, name, v string) error {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s=%q: want true or false", name, v)
+	}
+	*dst = b
+	return nil
+}
+
+// splitList разбирает список значений, разделённых запятыми.
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
 
-	return cfg
+// parseDuration разбирает неотрицательную длительность.
+func parseDuration(dst *time.Duration, name, v string) error {
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid %s=%q: want a non-negative duration", name, v)
+	}
+	*dst = d
+	return nil
 }
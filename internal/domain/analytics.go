@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Visitor — обезличенные сведения о том, кто перешёл по ссылке.
+type Visitor struct {
+	ReferrerHost string // пусто — прямой переход
+	Browser      string // класс User-Agent: chrome, firefox, bot, ...
+	Language     string // основной тег из Accept-Language
+	IPHash       string // хэш IP с солью; сам адрес не хранится
+	// Fingerprint — hex-хэш IP+User-Agent с солью, ключ для подсчёта уникальных
+	// посетителей. В сырые события не сохраняется.
+	Fingerprint string
+}
+
+// DailySketch — сериализованный HyperLogLog уникальных посетителей ссылки за сутки (UTC).
+type DailySketch struct {
+	Code   string
+	Day    time.Time
+	Sketch []byte
+}
+
+// StatsBucket — число переходов за интервал, начинающийся в Start.
+type StatsBucket struct {
+	Start   time.Time
+	Clicks  int64
+	Uniques int64 // только для дневного ряда
+}
+
+// CountEntry — значение измерения и число переходов с ним.
+type CountEntry struct {
+	Key   string
+	Count int64
+}
+
+// LinkStats — аналитика переходов по ссылке за период [From, To).
+type LinkStats struct {
+	Code        string
+	From        time.Time
+	To          time.Time
+	TotalClicks int64
+	// UniqueVisitors — приблизительная оценка; считается по целым суткам, покрывающим период.
+	UniqueVisitors int64
+	Hourly         []StatsBucket
+	Daily          []StatsBucket
+	TopReferrers   []CountEntry
+	TopBrowsers    []CountEntry
+}
+
+// TrendingLink — код и приблизительное число переходов за окно.
+type TrendingLink struct {
+	Code   string
+	Clicks int64
+}
+
+type AnalyticsRepository interface {
+	Migrate(ctx context.Context) error
+	SaveClicks(ctx context.Context, events []ClickEvent) error
+	// ClickStats возвращает ряды только по непустым интервалам; top ограничивает топы.
+	ClickStats(ctx context.Context, code string, from, to time.Time, top int) (*LinkStats, error)
+	// MergeSketches объединяет переданные скетчи с уже сохранёнными за те же сутки.
+	MergeSketches(ctx context.Context, sketches []DailySketch) error
+	// Sketches возвращает скетчи ссылки за сутки, пересекающиеся с [from, to).
+	Sketches(ctx context.Context, code string, from, to time.Time) ([]DailySketch, error)
+	// IPHashSalt возвращает сохранённую соль для хэширования IP, а если её
+	// ещё нет — сохраняет candidate. Так хэши сопоставимы между перезапусками
+	// и экземплярами с общим хранилищем.
+	IPHashSalt(ctx context.Context, candidate []byte) ([]byte, error)
+}
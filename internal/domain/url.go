@@ -2,7 +2,11 @@ package domain
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"net/http"
 	"time"
 )
 
@@ -12,20 +16,181 @@ type URL struct {
 	ExpiresAt   *time.Time
 	CreatedAt   time.Time
 	ClickCount  int64
+
+	// Отключённая ссылка остаётся в хранилище, но не редиректит (410 Gone).
+	Disabled       bool
+	DisabledReason string
+
+	// Version увеличивается при каждом изменении ссылки (оптимистичная блокировка).
+	Version int64
+
+	// RedirectStatus — HTTP-статус редиректа (301, 302, 307 или 308).
+	// 0 — ссылка создана до появления поля, см. Redirect.
+	RedirectStatus int
+}
+
+// Redirect — куда и с каким статусом перенаправлять по ссылке.
+type Redirect struct {
+	URL    string
+	Status int
+}
+
+// Redirect возвращает адрес и статус редиректа. Для ссылок без сохранённого
+// статуса — прежнее поведение: 301, но 302 для ссылок со сроком жизни.
+func (u *URL) Redirect() Redirect {
+	status := u.RedirectStatus
+	if status == 0 {
+		status = http.StatusMovedPermanently
+		if u.ExpiresAt != nil {
+			status = http.StatusFound
+		}
+	}
+	return Redirect{URL: u.OriginalURL, Status: status}
+}
+
+// ValidRedirectStatus сообщает, можно ли использовать status для редиректа по ссылке.
+func ValidRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// PermanentRedirect сообщает, кэшируется ли редирект браузерами навсегда.
+func PermanentRedirect(status int) bool {
+	return status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+}
+
+// LinkUpdate — изменение ссылки; поля со значением nil не меняются.
+// DisabledReason учитывается только вместе с Disabled == true.
+type LinkUpdate struct {
+	OriginalURL    *string
+	Disabled       *bool
+	DisabledReason string
+
+	// Host — хост, по которому клиент обратился к сервису: адрес на него
+	// считается ссылкой на сам сокращатель. Хранилище его не использует.
+	Host string
+}
+
+// ClickEvent — один переход по короткой ссылке.
+type ClickEvent struct {
+	Code string
+	At   time.Time
+	Visitor
 }
 
 type URLRepository interface {
 	Migrate(ctx context.Context) error
-	Create(ctx context.Context, code, originalURL string, expiresAt *time.Time) error
+	Create(ctx context.Context, code, originalURL string, expiresAt *time.Time, redirectStatus int) error
 	GetByCode(ctx context.Context, code string) (*URL, error)
+	Delete(ctx context.Context, code string) error
+	Disable(ctx context.Context, code, reason string) error
+	Enable(ctx context.Context, code string) error
+	// Update применяет изменения одной записью и увеличивает версию.
+	// ifVersion == 0 — без проверки версии, иначе при несовпадении
+	// возвращается ErrVersionConflict и ничего не меняется.
+	Update(ctx context.Context, code string, upd LinkUpdate, ifVersion int64) error
+	// IncrementClicks прибавляет к click_count накопленные приращения по кодам.
+	// Отсутствующие коды пропускаются.
+	IncrementClicks(ctx context.Context, deltas map[string]int64) error
+	// CreateBatch сохраняет пачку ссылок с заданными CreatedAt. Уже существующие
+	// коды пропускаются и возвращаются в skipped — это делает повторное
+	// проигрывание журнала идемпотентным.
+	CreateBatch(ctx context.Context, urls []URL) (skipped []string, err error)
+	// FindByURLHash возвращает действующие (не истёкшие и не отключённые)
+	// ссылки с данным URLHash адреса, новые первыми.
+	FindByURLHash(ctx context.Context, hash string) ([]URL, error)
+}
+
+// ShortenOptions — необязательные параметры создания короткой ссылки.
+type ShortenOptions struct {
+	ExpiresAt *time.Time
+	Alias     string // пользовательский код; пусто — сгенерировать случайный
+	// RedirectStatus — 301, 302, 307 или 308; 0 — по умолчанию сервиса
+	// (для ссылок со сроком жизни — временный редирект).
+	RedirectStatus int
+	// Host — хост, по которому клиент обратился к сервису: адрес на него
+	// считается ссылкой на сам сокращатель, даже если базовый URL не задан.
+	Host string
+}
+
+// ShortenResult — итог создания короткой ссылки.
+type ShortenResult struct {
+	Code           string
+	ExpiresAt      *time.Time
+	RedirectStatus int
+	// Existing — вернули уже существующую ссылку на тот же адрес (дедупликация).
+	Existing bool
 }
 
 type URLService interface {
-	Shorten(ctx context.Context, originalURL string, expiresAt *time.Time) (string, error)
-	Resolve(ctx context.Context, code string) (string, error)
+	Shorten(ctx context.Context, originalURL string, opts ShortenOptions) (ShortenResult, error)
+	Resolve(ctx context.Context, code string, v Visitor) (Redirect, error)
+	// GetLink возвращает ссылку целиком из хранилища, минуя кэш редиректов.
+	GetLink(ctx context.Context, code string) (*URL, error)
+	DeleteLink(ctx context.Context, code string) error
+	DisableLink(ctx context.Context, code, reason string) error
+	EnableLink(ctx context.Context, code string) error
+	// UpdateLink атомарно меняет адрес назначения и/или отключение ссылки.
+	UpdateLink(ctx context.Context, code string, upd LinkUpdate, ifVersion int64) error
+	// Stats возвращает аналитику переходов за период [from, to).
+	Stats(ctx context.Context, code string, from, to time.Time) (*LinkStats, error)
+	// Trending возвращает самые популярные ссылки за последние window.
+	Trending(ctx context.Context, window time.Duration, limit int) ([]TrendingLink, error)
 }
 
 var (
 	ErrCodeAlreadyExists = errors.New("short code already exists")
 	ErrURLNotFound       = errors.New("short url not found")
+	ErrURLExpired        = errors.New("short url expired")
+	ErrURLDisabled       = errors.New("short url disabled")
+	ErrVersionConflict   = errors.New("short url was modified concurrently")
+	ErrStatsDisabled     = errors.New("click analytics is disabled")
+	ErrInvalidPeriod     = errors.New("invalid period")
+	ErrTrendingDisabled  = errors.New("trending is disabled")
+	ErrInvalidExpiry     = errors.New("invalid expiration")
+	ErrInvalidAlias      = errors.New("invalid alias")
+	ErrInvalidURL        = errors.New("invalid url")
+	ErrURLBlocked        = errors.New("destination is blocked by policy")
+	ErrInvalidRedirect   = errors.New("invalid redirect status")
 )
+
+// URLError — адрес назначения не прошёл проверку. Rule — имя нарушенного
+// правила (length, syntax, scheme, host, port, userinfo, policy), Reason — пояснение
+// для клиента. errors.Is(err, ErrInvalidURL) == true.
+type URLError struct {
+	Rule   string
+	Reason string
+}
+
+func (e *URLError) Error() string {
+	return fmt.Sprintf("invalid url: %s: %s", e.Rule, e.Reason)
+}
+
+func (e *URLError) Unwrap() error { return ErrInvalidURL }
+
+// TypoError — код не прошёл проверку контрольного символа, то есть это
+// опечатка, а не неизвестная ссылка. Suggestions — существующие коды,
+// отличающиеся одним символом. errors.Is(err, ErrURLNotFound) == true.
+type TypoError struct {
+	Code        string
+	Suggestions []string
+}
+
+func (e *TypoError) Error() string {
+	return fmt.Sprintf("short code %q looks mistyped", e.Code)
+}
+
+func (e *TypoError) Unwrap() error { return ErrURLNotFound }
+
+// URLHash — ключ дедупликации: SHA-256 от адреса назначения в том
+// каноническом виде, в котором его сохраняет сервис (см. нормализацию в
+// service.WithURLRules). Фрагмент — часть адреса и в ключ входит. Ключ только
+// сужает поиск: совпадение адресов проверяется сравнением целиком.
+// Когда у ссылок появятся владельцы, ключ должен включать и владельца.
+func URLHash(normalizedURL string) string {
+	sum := sha256.Sum256([]byte(normalizedURL))
+	return hex.EncodeToString(sum[:])
+}
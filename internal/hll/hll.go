@@ -0,0 +1,115 @@
+// Package hll реализует HyperLogLog — вероятностную оценку числа уникальных
+// элементов в фиксированном объёме памяти (2^precision байт на скетч).
+package hll
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+const (
+	// DefaultPrecision даёт 4096 регистров (4 КиБ) и стандартную ошибку ~1.6%.
+	DefaultPrecision = 12
+
+	minPrecision = 4
+	maxPrecision = 16
+
+	encodingVersion = 1
+)
+
+var ErrInvalidSketch = errors.New("hll: invalid sketch encoding")
+
+// Sketch не потокобезопасен: синхронизация на стороне вызывающего.
+type Sketch struct {
+	p   uint8
+	reg []uint8
+}
+
+func New(precision uint8) *Sketch {
+	if precision < minPrecision {
+		precision = minPrecision
+	}
+	if precision > maxPrecision {
+		precision = maxPrecision
+	}
+	return &Sketch{p: precision, reg: make([]uint8, 1<<precision)}
+}
+
+// Add учитывает элемент по его 64-битному хэшу. Хэш должен быть равномерно
+// распределён по всем битам (например, префикс SHA-256).
+func (s *Sketch) Add(hash uint64) {
+	idx := hash >> (64 - s.p)
+	// ведущие нули считаем по оставшимся битам; сторожевой бит ограничивает результат
+	w := hash<<s.p | 1<<(s.p-1)
+	rho := uint8(bits.LeadingZeros64(w)) + 1
+	if rho > s.reg[idx] {
+		s.reg[idx] = rho
+	}
+}
+
+// Estimate возвращает оценку числа уникальных элементов.
+func (s *Sketch) Estimate() uint64 {
+	m := float64(len(s.reg))
+
+	var sum float64
+	zeros := 0
+	for _, r := range s.reg {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	est := alpha * m * m / sum
+
+	// на малых значениях сырая оценка смещена — переходим на linear counting
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(est + 0.5)
+}
+
+// Merge объединяет other в s (оценка объединения множеств).
+func (s *Sketch) Merge(other *Sketch) error {
+	if other.p != s.p {
+		return errors.New("hll: cannot merge sketches with different precision")
+	}
+	for i, r := range other.reg {
+		if r > s.reg[i] {
+			s.reg[i] = r
+		}
+	}
+	return nil
+}
+
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 2+len(s.reg))
+	out[0] = encodingVersion
+	out[1] = s.p
+	copy(out[2:], s.reg)
+	return out, nil
+}
+
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || data[0] != encodingVersion {
+		return ErrInvalidSketch
+	}
+	p := data[1]
+	if p < minPrecision || p > maxPrecision || len(data) != 2+1<<p {
+		return ErrInvalidSketch
+	}
+	s.p = p
+	s.reg = append(s.reg[:0], data[2:]...)
+	return nil
+}
+
+// Decode — удобная обёртка над UnmarshalBinary.
+func Decode(data []byte) (*Sketch, error) {
+	s := &Sketch{}
+	if err := s.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,73 @@
+package hll
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func hashOf(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+func TestEstimateAccuracy(t *testing.T) {
+	for _, n := range []int{0, 10, 1000, 100_000} {
+		s := New(DefaultPrecision)
+		for i := 0; i < n; i++ {
+			h := hashOf("visitor-" + strconv.Itoa(i))
+			s.Add(h)
+			s.Add(h) // повторы не должны влиять
+		}
+
+		got := float64(s.Estimate())
+		if n == 0 {
+			if got != 0 {
+				t.Fatalf("n=0: estimate = %v, want 0", got)
+			}
+			continue
+		}
+		if relErr := math.Abs(got-float64(n)) / float64(n); relErr > 0.05 {
+			t.Fatalf("n=%d: estimate = %v, relative error %.3f > 0.05", n, got, relErr)
+		}
+	}
+}
+
+func TestMergeAndEncoding(t *testing.T) {
+	a, b := New(DefaultPrecision), New(DefaultPrecision)
+	for i := 0; i < 5000; i++ {
+		a.Add(hashOf("a-" + strconv.Itoa(i)))
+		b.Add(hashOf("b-" + strconv.Itoa(i)))
+		// общие элементы
+		a.Add(hashOf("both-" + strconv.Itoa(i)))
+		b.Add(hashOf("both-" + strconv.Itoa(i)))
+	}
+
+	data, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded.Estimate() != b.Estimate() {
+		t.Fatalf("decoded estimate = %d, want %d", decoded.Estimate(), b.Estimate())
+	}
+
+	if err := a.Merge(decoded); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if got := float64(a.Estimate()); math.Abs(got-15000)/15000 > 0.05 {
+		t.Fatalf("merged estimate = %v, want ~15000", got)
+	}
+
+	if _, err := Decode(data[:10]); err == nil {
+		t.Fatalf("decode truncated: want error")
+	}
+	if err := a.Merge(New(10)); err == nil {
+		t.Fatalf("merge different precision: want error")
+	}
+}
@@ -0,0 +1,421 @@
+// Package journal — локальный журнал созданных ссылок. Запись считается
+// принятой только после fsync, поэтому при падении БД или процесса ссылки,
+// ещё не попавшие в хранилище, восстанавливаются повторным проигрыванием.
+//
+// Журнал — каталог с сегментами. Записи снабжены длиной и CRC, так что
+// оборванный хвост последнего сегмента отбрасывается, а порча в середине
+// обнаруживается. Подтверждение (Confirm) тоже пишется в журнал, поэтому
+// подтверждённые записи не проигрываются и после перезапуска — иначе вернулись
+// бы удалённые или отменённые ссылки. Сегменты без неподтверждённых записей
+// удаляются с начала журнала: в более новых сегментах могут лежать
+// подтверждения записей из более старых.
+package journal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const segmentExt = ".seg"
+
+type Options struct {
+	// SegmentSize — после какого размера открывается новый сегмент (64 МБ по умолчанию).
+	SegmentSize int64
+}
+
+type segment struct {
+	id   uint64
+	path string
+	size int64
+	open int // неподтверждённых записей
+}
+
+// Stats — состояние журнала для метрик.
+type Stats struct {
+	Segments    int   `json:"segments"`
+	Unconfirmed int   `json:"unconfirmed"`
+	Bytes       int64 `json:"bytes"`
+	// Truncated — сколько байт оборванного хвоста отброшено при открытии.
+	Truncated int64 `json:"truncated"`
+}
+
+type Journal struct {
+	dir  string
+	opts Options
+
+	// mu защищает сегменты и запись; syncMu выстраивает fsync в очередь,
+	// чтобы одновременные Append разделили один fsync (group commit).
+	mu        sync.Mutex
+	syncMu    sync.Mutex
+	segments  []*segment // по возрастанию id, последний — активный
+	f         *os.File   // файл активного сегмента
+	owner     map[string]recordRef
+	written   int64 // сколько байт записано за время жизни журнала
+	synced    int64 // до какого значения written данные гарантированно на диске
+	truncated int64
+}
+
+// recordRef указывает на последнюю неподтверждённую запись кода.
+type recordRef struct {
+	seg *segment
+	off int64
+}
+
+// Open открывает журнал в каталоге dir (создаёт при необходимости), проверяет
+// существующие сегменты и начинает новый активный сегмент. Неподтверждёнными
+// считаются записи, для которых в журнале нет подтверждения.
+func Open(dir string, opts Options) (*Journal, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = 64 << 20
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create journal dir: %w", err)
+	}
+
+	j := &Journal{
+		dir:   dir,
+		opts:  opts,
+		owner: make(map[string]recordRef),
+	}
+
+	ids, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range ids {
+		seg := &segment{id: id, path: j.segmentPath(id)}
+		if err := j.scan(seg, i == len(ids)-1); err != nil {
+			return nil, err
+		}
+		j.segments = append(j.segments, seg)
+	}
+	// подтверждения могут лежать в более поздних сегментах, поэтому
+	// подтверждённые сегменты удаляем только после чтения всех
+	for len(j.segments) > 0 && j.segments[0].open <= 0 {
+		if err := os.Remove(j.segments[0].path); err != nil {
+			return nil, err
+		}
+		j.segments = j.segments[1:]
+	}
+
+	var next uint64 = 1
+	if len(ids) > 0 {
+		next = ids[len(ids)-1] + 1
+	}
+	if err := j.openSegment(next); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+	return ids, nil
+}
+
+func (j *Journal) segmentPath(id uint64) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%016d%s", id, segmentExt))
+}
+
+// scan проверяет сегмент и регистрирует его записи. Оборванный или
+// испорченный хвост допустим только в последнем сегменте — там его обрезаем.
+func (j *Journal) scan(seg *segment, last bool) error {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var off int64
+	for {
+		e, n, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if !last {
+				return fmt.Errorf("journal %s at offset %d: %w", seg.path, off, ErrCorrupt)
+			}
+			st, statErr := f.Stat()
+			if statErr != nil {
+				return statErr
+			}
+			if err := os.Truncate(seg.path, off); err != nil {
+				return err
+			}
+			j.truncated += st.Size() - off
+			break
+		}
+		if e.acks != nil {
+			j.ack(e.acks)
+		} else {
+			j.own(e.rec.Code, seg, off)
+		}
+		off += int64(n)
+	}
+	seg.size = off
+	return nil
+}
+
+func (j *Journal) own(code string, seg *segment, off int64) {
+	if prev, ok := j.owner[code]; ok {
+		// более поздняя запись с тем же кодом заменяет прежнюю
+		prev.seg.open--
+	}
+	j.owner[code] = recordRef{seg: seg, off: off}
+	seg.open++
+}
+
+// ack снимает коды с учёта. Возвращает те, что действительно ждали подтверждения.
+func (j *Journal) ack(codes []string) []string {
+	acked := codes[:0:0]
+	for _, code := range codes {
+		ref, ok := j.owner[code]
+		if !ok {
+			continue
+		}
+		delete(j.owner, code)
+		ref.seg.open--
+		acked = append(acked, code)
+	}
+	return acked
+}
+
+func (j *Journal) openSegment(id uint64) error {
+	seg := &segment{id: id, path: j.segmentPath(id)}
+	f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	j.f = f
+	j.segments = append(j.segments, seg)
+	return nil
+}
+
+func (j *Journal) active() *segment {
+	return j.segments[len(j.segments)-1]
+}
+
+// Append дописывает запись и дожидается fsync. Одновременные вызовы
+// объединяются в один fsync.
+func (j *Journal) Append(rec Record) error {
+	j.mu.Lock()
+	seg, off, err := j.write(encodeRecord(rec))
+	if err != nil {
+		j.mu.Unlock()
+		return err
+	}
+	j.own(rec.Code, seg, off)
+	pos := j.written
+	j.mu.Unlock()
+
+	return j.syncTo(pos)
+}
+
+// write дописывает запись в активный сегмент, при необходимости открывая
+// новый. Возвращает сегмент и смещение записи. Вызывается под mu.
+func (j *Journal) write(buf []byte) (*segment, int64, error) {
+	if seg := j.active(); seg.size > 0 && seg.size+int64(len(buf)) > j.opts.SegmentSize {
+		if err := j.rotate(); err != nil {
+			return nil, 0, err
+		}
+	}
+	if _, err := j.f.Write(buf); err != nil {
+		return nil, 0, err
+	}
+	seg := j.active()
+	off := seg.size
+	seg.size += int64(len(buf))
+	j.written += int64(len(buf))
+	return seg, off, nil
+}
+
+// syncTo гарантирует, что на диске всё до позиции pos. Пока один вызов
+// делает fsync, остальные копятся на syncMu и затем часто обнаруживают,
+// что их данные уже сброшены.
+func (j *Journal) syncTo(pos int64) error {
+	j.syncMu.Lock()
+	defer j.syncMu.Unlock()
+
+	if j.synced >= pos {
+		return nil
+	}
+
+	j.mu.Lock()
+	target := j.written
+	err := j.f.Sync()
+	j.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	j.synced = target
+	return nil
+}
+
+// rotate закрывает активный сегмент и открывает следующий. Вызывается под mu.
+func (j *Journal) rotate() error {
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	if err := j.f.Close(); err != nil {
+		return err
+	}
+	return j.openSegment(j.active().id + 1)
+}
+
+// Confirm отмечает записи как сохранённые в хранилище (или отменённые) и
+// дожидается, пока подтверждение окажется на диске: после перезапуска такие
+// записи не проигрываются. Подтверждённые сегменты с начала журнала
+// удаляются, а если не осталось ничего, активный сегмент обнуляется.
+func (j *Journal) Confirm(codes ...string) error {
+	j.mu.Lock()
+
+	var pending []string
+	for _, code := range codes {
+		if _, ok := j.owner[code]; ok {
+			pending = append(pending, code)
+		}
+	}
+	if len(pending) == 0 {
+		j.mu.Unlock()
+		return nil
+	}
+
+	for len(pending) > 0 {
+		n := min(len(pending), maxAckCodes)
+		if _, _, err := j.write(encodeAck(pending[:n])); err != nil {
+			j.mu.Unlock()
+			return err
+		}
+		j.ack(pending[:n])
+		pending = pending[n:]
+	}
+	pos := j.written
+
+	err := j.compact()
+	j.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return j.syncTo(pos)
+}
+
+// compact удаляет полностью подтверждённые сегменты с начала журнала.
+// Подтверждённый сегмент в середине остаётся: в нём могут быть подтверждения
+// записей из более старых сегментов. Вызывается под mu.
+func (j *Journal) compact() error {
+	for len(j.segments) > 1 && j.segments[0].open <= 0 {
+		if err := os.Remove(j.segments[0].path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		j.segments = j.segments[1:]
+	}
+
+	if active := j.active(); len(j.segments) == 1 && active.open <= 0 && active.size > 0 {
+		if err := j.f.Truncate(0); err != nil {
+			return err
+		}
+		active.size = 0
+	}
+	return nil
+}
+
+// Records вызывает fn для каждой неподтверждённой записи в порядке записи.
+func (j *Journal) Records(fn func(Record) error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, seg := range j.segments {
+		if err := j.readSegment(seg, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *Journal) readSegment(seg *segment, fn func(Record) error) error {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(io.LimitReader(f, seg.size))
+	var off int64
+	for {
+		e, n, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("journal %s: %w", seg.path, err)
+		}
+		at := off
+		off += int64(n)
+		if e.acks != nil || j.owner[e.rec.Code] != (recordRef{seg: seg, off: at}) {
+			continue
+		}
+		if err := fn(e.rec); err != nil {
+			return err
+		}
+	}
+}
+
+func (j *Journal) Stats() Stats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	st := Stats{
+		Segments:    len(j.segments),
+		Unconfirmed: len(j.owner),
+		Truncated:   j.truncated,
+	}
+	for _, seg := range j.segments {
+		st.Bytes += seg.size
+	}
+	return st
+}
+
+// Close сбрасывает активный сегмент на диск. Если в журнале не осталось
+// неподтверждённых записей, файл удаляется.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.f.Sync(); err != nil {
+		j.f.Close()
+		return err
+	}
+	if err := j.f.Close(); err != nil {
+		return err
+	}
+	if active := j.active(); len(j.segments) == 1 && active.open <= 0 {
+		return os.Remove(active.path)
+	}
+	return nil
+}
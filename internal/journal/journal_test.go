@@ -0,0 +1,257 @@
+package journal
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"shortener/internal/repo/memory"
+)
+
+func records(t *testing.T, j *Journal) []Record {
+	t.Helper()
+	var out []Record
+	if err := j.Records(func(rec Record) error {
+		out = append(out, rec)
+		return nil
+	}); err != nil {
+		t.Fatalf("records: %v", err)
+	}
+	return out
+}
+
+func TestReopenKeepsUnconfirmed(t *testing.T) {
+	dir := t.TempDir()
+	exp := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	j, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for i, rec := range []Record{
+		{Code: "aaa", URL: "https://example.com/a", CreatedAt: time.Now()},
+		{Code: "bbb", URL: "https://example.com/b", CreatedAt: time.Now(), ExpiresAt: &exp, RedirectStatus: 307},
+		{Code: "ccc", URL: "https://example.com/c", CreatedAt: time.Now()},
+	} {
+		if err := j.Append(rec); err != nil {
+			t.Fatalf("append %d: %v", i, err)
+		}
+	}
+	if err := j.Confirm("aaa"); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	j, err = Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer j.Close()
+
+	got := records(t, j)
+	if len(got) != 2 || got[1].Code != "ccc" {
+		t.Fatalf("records = %+v, want bbb and ccc", got)
+	}
+	if got[0].Code != "bbb" || got[0].ExpiresAt == nil || !got[0].ExpiresAt.Equal(exp) || got[0].RedirectStatus != 307 {
+		t.Fatalf("record = %+v, want bbb with expiry %v and redirect 307", got[0], exp)
+	}
+}
+
+func TestConfirmSurvivesRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	j, err := Open(dir, Options{SegmentSize: 100})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for i := range 6 {
+		code := fmt.Sprintf("code%04d", i)
+		if err := j.Append(Record{Code: code, URL: "https://example.com/" + code, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	// подтверждение записи из середины: её сегмент остаётся, пока не
+	// подтверждены более старые
+	if err := j.Confirm("code0003"); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	j, err = Open(dir, Options{SegmentSize: 100})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer j.Close()
+
+	for _, rec := range records(t, j) {
+		if rec.Code == "code0003" {
+			t.Fatalf("confirmed record replayed after reopen")
+		}
+	}
+	if st := j.Stats(); st.Unconfirmed != 5 {
+		t.Fatalf("unconfirmed = %d, want 5", st.Unconfirmed)
+	}
+}
+
+func TestDecodeVersion1Record(t *testing.T) {
+	// запись в формате до появления статуса редиректа
+	p := []byte{1}
+	p = binary.AppendUvarint(p, 3)
+	p = append(p, "old"...)
+	p = binary.AppendUvarint(p, 21)
+	p = append(p, "https://example.com/o"...)
+	p = binary.AppendVarint(p, time.Now().UnixNano())
+	p = binary.AppendVarint(p, 0)
+
+	rec, err := decodePayload(p)
+	if err != nil || rec.Code != "old" || rec.URL != "https://example.com/o" || rec.RedirectStatus != 0 {
+		t.Fatalf("decode v1 = %+v, %v", rec, err)
+	}
+}
+
+func TestTornTailIsTruncated(t *testing.T) {
+	dir := t.TempDir()
+
+	j, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, code := range []string{"aaa", "bbb"} {
+		if err := j.Append(Record{Code: code, URL: "https://example.com/" + code, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	path := j.active().path
+	j.Close()
+
+	// имитируем падение посреди записи последней записи
+	st, _ := os.Stat(path)
+	if err := os.Truncate(path, st.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err = Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer j.Close()
+
+	got := records(t, j)
+	if len(got) != 1 || got[0].Code != "aaa" {
+		t.Fatalf("records = %+v, want only aaa", got)
+	}
+	if j.Stats().Truncated == 0 {
+		t.Fatal("expected truncated bytes to be reported")
+	}
+}
+
+func TestCorruptSealedSegment(t *testing.T) {
+	dir := t.TempDir()
+
+	j, err := Open(dir, Options{SegmentSize: 1})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, code := range []string{"aaa", "bbb"} {
+		if err := j.Append(Record{Code: code, URL: "https://example.com/" + code, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	first := j.segments[0].path
+	j.Close()
+
+	data, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(first, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(dir, Options{}); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("open corrupted: err = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestRotationAndCompaction(t *testing.T) {
+	dir := t.TempDir()
+
+	j, err := Open(dir, Options{SegmentSize: 100})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer j.Close()
+
+	var codes []string
+	for i := range 10 {
+		code := fmt.Sprintf("code%04d", i)
+		codes = append(codes, code)
+		if err := j.Append(Record{Code: code, URL: "https://example.com/" + code, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	if st := j.Stats(); st.Segments < 3 || st.Unconfirmed != 10 {
+		t.Fatalf("stats = %+v, want several segments and 10 unconfirmed", st)
+	}
+
+	if err := j.Confirm(codes[:5]...); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if got := records(t, j); len(got) != 5 || got[0].Code != "code0005" {
+		t.Fatalf("records after confirm = %d (first %+v)", len(got), got[0])
+	}
+
+	if err := j.Confirm(codes[5:]...); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if st := j.Stats(); st.Segments != 1 || st.Unconfirmed != 0 || st.Bytes != 0 {
+		t.Fatalf("stats after full confirm = %+v, want one empty segment", st)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if len(files) != 1 {
+		t.Fatalf("segment files = %v, want only the active one", files)
+	}
+}
+
+func TestReplayIntoRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.New()
+	if err := repo.Create(ctx, "saved", "https://example.com/saved", nil, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := Open(t.TempDir(), Options{})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer j.Close()
+	for _, code := range []string{"saved", "lost"} {
+		if err := j.Append(Record{Code: code, URL: "https://example.com/" + code, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	n, err := Replay(ctx, j, repo)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("restored = %d, want 1", n)
+	}
+	if u, err := repo.GetByCode(ctx, "lost"); err != nil || u.OriginalURL != "https://example.com/lost" {
+		t.Fatalf("restored link = %+v, %v", u, err)
+	}
+	if st := j.Stats(); st.Unconfirmed != 0 {
+		t.Fatalf("unconfirmed after replay = %d", st.Unconfirmed)
+	}
+}
@@ -0,0 +1,210 @@
+package journal
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// Формат записи на диске:
+//
+//	[len uint32][crc32c uint32][payload]
+//
+// payload: версия, code и url (uvarint-длина + байты), created_at и
+// expires_at (unix nano, varint; 0 — без срока), с версии 2 — статус
+// редиректа (uvarint). Записи версии 1 читаются со статусом 0.
+//
+// Подтверждение (Confirm) — отдельная запись: ackMarker, число кодов
+// (uvarint) и сами коды (uvarint-длина + байты).
+const (
+	headerSize    = 8
+	recordVersion = 2
+	ackMarker     = 0x80
+
+	// maxAckCodes — сколько кодов помещается в одну запись подтверждения
+	maxAckCodes = 1024
+
+	// maxPayload отсекает мусор в заголовке, чтобы не аллоцировать гигабайты
+	maxPayload = 1 << 20
+)
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	// errTorn — запись оборвана на середине (процесс упал во время write).
+	errTorn = errors.New("torn record")
+	// ErrCorrupt — контрольная сумма или содержимое записи не сходятся.
+	ErrCorrupt = errors.New("journal: corrupt record")
+)
+
+type Record struct {
+	Code           string
+	URL            string
+	ExpiresAt      *time.Time
+	CreatedAt      time.Time
+	RedirectStatus int
+}
+
+// entry — прочитанная из сегмента запись: ссылка или подтверждение кодов.
+type entry struct {
+	rec  Record
+	acks []string
+}
+
+func encodeRecord(rec Record) []byte {
+	payload := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(rec.Code)+len(rec.URL)+2*binary.MaxVarintLen64)
+	payload = append(payload, recordVersion)
+	payload = binary.AppendUvarint(payload, uint64(len(rec.Code)))
+	payload = append(payload, rec.Code...)
+	payload = binary.AppendUvarint(payload, uint64(len(rec.URL)))
+	payload = append(payload, rec.URL...)
+	payload = binary.AppendVarint(payload, rec.CreatedAt.UnixNano())
+	var exp int64
+	if rec.ExpiresAt != nil {
+		exp = rec.ExpiresAt.UnixNano()
+	}
+	payload = binary.AppendVarint(payload, exp)
+	payload = binary.AppendUvarint(payload, uint64(rec.RedirectStatus))
+	return frame(payload)
+}
+
+func encodeAck(codes []string) []byte {
+	payload := []byte{ackMarker}
+	payload = binary.AppendUvarint(payload, uint64(len(codes)))
+	for _, code := range codes {
+		payload = binary.AppendUvarint(payload, uint64(len(code)))
+		payload = append(payload, code...)
+	}
+	return frame(payload)
+}
+
+// frame добавляет к payload заголовок с длиной и CRC.
+func frame(payload []byte) []byte {
+	buf := make([]byte, headerSize, headerSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	return append(buf, payload...)
+}
+
+// readRecord читает одну запись и возвращает её размер на диске.
+// io.EOF — чистый конец файла, errTorn — недописанный хвост.
+func readRecord(r io.Reader) (entry, int, error) {
+	var hdr [headerSize]byte
+	n, err := io.ReadFull(r, hdr[:])
+	if err == io.EOF {
+		return entry{}, 0, io.EOF
+	}
+	if err != nil {
+		return entry{}, n, errTorn
+	}
+
+	size := binary.LittleEndian.Uint32(hdr[0:4])
+	sum := binary.LittleEndian.Uint32(hdr[4:8])
+	if size == 0 || size > maxPayload {
+		return entry{}, n, ErrCorrupt
+	}
+
+	payload := make([]byte, size)
+	m, err := io.ReadFull(r, payload)
+	n += m
+	if err != nil {
+		return entry{}, n, errTorn
+	}
+	if crc32.Checksum(payload, crcTable) != sum {
+		return entry{}, n, ErrCorrupt
+	}
+
+	if payload[0] == ackMarker {
+		acks, err := decodeAck(payload[1:])
+		return entry{acks: acks}, n, err
+	}
+	rec, err := decodePayload(payload)
+	if err != nil {
+		return entry{}, n, err
+	}
+	return entry{rec: rec}, n, nil
+}
+
+func decodeAck(p []byte) ([]string, error) {
+	count, k := binary.Uvarint(p)
+	if k <= 0 || count > uint64(len(p)) {
+		return nil, ErrCorrupt
+	}
+	p = p[k:]
+	codes := make([]string, 0, count)
+	for range count {
+		l, k := binary.Uvarint(p)
+		if k <= 0 || uint64(len(p)-k) < l {
+			return nil, ErrCorrupt
+		}
+		codes = append(codes, string(p[k:k+int(l)]))
+		p = p[k+int(l):]
+	}
+	if len(p) != 0 {
+		return nil, ErrCorrupt
+	}
+	return codes, nil
+}
+
+func decodePayload(p []byte) (Record, error) {
+	if len(p) == 0 || p[0] < 1 || p[0] > recordVersion {
+		return Record{}, ErrCorrupt
+	}
+	version := p[0]
+	p = p[1:]
+
+	readString := func() (string, bool) {
+		l, k := binary.Uvarint(p)
+		if k <= 0 || uint64(len(p)-k) < l {
+			return "", false
+		}
+		s := string(p[k : k+int(l)])
+		p = p[k+int(l):]
+		return s, true
+	}
+	readInt := func() (int64, bool) {
+		v, k := binary.Varint(p)
+		if k <= 0 {
+			return 0, false
+		}
+		p = p[k:]
+		return v, true
+	}
+
+	var rec Record
+	var ok bool
+	if rec.Code, ok = readString(); !ok {
+		return Record{}, ErrCorrupt
+	}
+	if rec.URL, ok = readString(); !ok {
+		return Record{}, ErrCorrupt
+	}
+	created, ok := readInt()
+	if !ok {
+		return Record{}, ErrCorrupt
+	}
+	exp, ok := readInt()
+	if !ok {
+		return Record{}, ErrCorrupt
+	}
+	if version >= 2 {
+		status, k := binary.Uvarint(p)
+		if k <= 0 {
+			return Record{}, ErrCorrupt
+		}
+		p = p[k:]
+		rec.RedirectStatus = int(status)
+	}
+	if len(p) != 0 {
+		return Record{}, ErrCorrupt
+	}
+
+	rec.CreatedAt = time.Unix(0, created).UTC()
+	if exp != 0 {
+		t := time.Unix(0, exp).UTC()
+		rec.ExpiresAt = &t
+	}
+	return rec, nil
+}
@@ -0,0 +1,49 @@
+package journal
+
+import (
+	"context"
+
+	"shortener/internal/domain"
+)
+
+const replayBatch = 500
+
+// Replay дозаписывает в repo неподтверждённые записи журнала и подтверждает
+// их. Уже существующие в хранилище коды пропускаются, поэтому повторный
+// вызов безопасен. Возвращает число восстановленных ссылок.
+func Replay(ctx context.Context, j *Journal, repo domain.URLRepository) (int, error) {
+	var batch []domain.URL
+	if err := j.Records(func(rec Record) error {
+		batch = append(batch, domain.URL{
+			Code:        rec.Code,
+			OriginalURL: rec.URL,
+			ExpiresAt:   rec.ExpiresAt,
+			CreatedAt:   rec.CreatedAt,
+
+			RedirectStatus: rec.RedirectStatus,
+		})
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for len(batch) > 0 {
+		n := min(len(batch), replayBatch)
+		skipped, err := repo.CreateBatch(ctx, batch[:n])
+		if err != nil {
+			return restored, err
+		}
+		restored += n - len(skipped)
+
+		codes := make([]string, n)
+		for i, u := range batch[:n] {
+			codes[i] = u.Code
+		}
+		if err := j.Confirm(codes...); err != nil {
+			return restored, err
+		}
+		batch = batch[n:]
+	}
+	return restored, nil
+}
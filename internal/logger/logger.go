@@ -9,7 +9,7 @@ import (
 
 type asyncHandler struct {
 	ch   chan logEntry
-	wg   sync.WaitGroup
+	wg   *sync.WaitGroup
 	done chan struct{}
 	out  slog.Handler
 }
@@ -23,6 +23,7 @@ func NewAsyncHandler(out slog.Handler, buffer int) slog.Handler {
 	h := &asyncHandler{
 		ch:   make(chan logEntry, buffer),
 		out:  out,
+		wg:   &sync.WaitGroup{},
 		done: make(chan struct{}),
 	}
 	h.wg.Add(1)
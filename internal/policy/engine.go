@@ -0,0 +1,41 @@
+package policy
+
+import (
+	"sync/atomic"
+)
+
+// Engine хранит текущую политику и позволяет заменить её на лету.
+// Безопасен для конкурентного использования.
+type Engine struct {
+	path string
+	cur  atomic.Pointer[Policy]
+}
+
+// NewEngine загружает политику из path; пустой path — только встроенные правила.
+func NewEngine(path string) (*Engine, error) {
+	e := &Engine{path: path}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reload перечитывает файл политики. При ошибке продолжает действовать
+// прежняя политика.
+func (e *Engine) Reload() error {
+	p := Default()
+	if e.path != "" {
+		var err error
+		if p, err = Load(e.path); err != nil {
+			return err
+		}
+	}
+	e.cur.Store(p)
+	return nil
+}
+
+func (e *Engine) Path() string { return e.path }
+
+func (e *Engine) CheckURL(rawURL string) Decision {
+	return e.cur.Load().CheckURL(rawURL)
+}
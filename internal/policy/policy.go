@@ -0,0 +1,245 @@
+// Package policy решает, на какие адреса можно делать короткие ссылки и
+// переходить по ним, чтобы короткий домен нельзя было использовать для
+// маскировки вредоносных сайтов и обращений к внутренним адресам.
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+
+	"shortener/internal/punycode"
+)
+
+// Decision — результат проверки адреса. Rule — строка правила, которое
+// сработало; пусто, если действует правило по умолчанию.
+type Decision struct {
+	Allowed bool
+	Rule    string
+}
+
+type domainRule struct {
+	allow    bool
+	suffix   string // без "*."
+	wildcard bool   // "*.example.com" — только поддомены
+	text     string
+}
+
+type cidrRule struct {
+	allow  bool
+	prefix netip.Prefix
+	text   string
+}
+
+// Policy — неизменяемый набор правил.
+//
+// Формат файла — по правилу в строке, # начинает комментарий:
+//
+//	deny  evil.example          # ровно этот хост
+//	deny  *.malware.example     # любые поддомены
+//	allow good.malware.example
+//	deny  203.0.113.0/24        # IP-адреса, записанные в ссылке буквально
+//	allow 10.1.2.3
+//	default deny                # для хостов без подходящего правила
+//
+// Срабатывает самое точное правило: больше меток домена, длиннее префикс
+// подсети, точное имя точнее шаблона с той же частью. При равенстве
+// побеждает deny. Частные, loopback и link-local адреса, а также localhost,
+// запрещены встроенными правилами, которые можно переопределить allow.
+type Policy struct {
+	domains      []domainRule
+	cidrs        []cidrRule
+	defaultAllow bool
+}
+
+// builtin — правила, действующие всегда, ниже любых правил из файла.
+var builtin = []string{
+	"deny localhost",
+	"deny *.localhost",
+	"deny 0.0.0.0/8",
+	"deny 10.0.0.0/8",
+	"deny 100.64.0.0/10",
+	"deny 127.0.0.0/8",
+	"deny 169.254.0.0/16",
+	"deny 172.16.0.0/12",
+	"deny 192.168.0.0/16",
+	"deny 224.0.0.0/4",
+	"deny 240.0.0.0/4",
+	"deny ::/128",
+	"deny ::1/128",
+	"deny fc00::/7",
+	"deny fe80::/10",
+	"deny ff00::/8",
+}
+
+// Default возвращает политику только со встроенными правилами.
+func Default() *Policy {
+	p, err := Parse(strings.NewReader(""))
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Load читает политику из файла.
+func Load(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open policy: %w", err)
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse разбирает правила из r (формат — см. Policy).
+func Parse(r io.Reader) (*Policy, error) {
+	p := &Policy{defaultAllow: true}
+	for _, line := range builtin {
+		if err := p.add(line); err != nil {
+			return nil, err
+		}
+	}
+
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if err := p.add(line); err != nil {
+			return nil, fmt.Errorf("policy line %d: %w", n, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+	return p, nil
+}
+
+func (p *Policy) add(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		return fmt.Errorf("want \"allow|deny|default <value>\", got %q", line)
+	}
+	action, value := strings.ToLower(fields[0]), strings.ToLower(fields[1])
+
+	var allow bool
+	switch action {
+	case "allow":
+		allow = true
+	case "deny":
+	case "default":
+		switch value {
+		case "allow":
+			p.defaultAllow = true
+		case "deny":
+			p.defaultAllow = false
+		default:
+			return fmt.Errorf("default must be allow or deny, got %q", value)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown action %q", fields[0])
+	}
+
+	text := action + " " + value
+	if pfx, err := netip.ParsePrefix(value); err == nil {
+		p.cidrs = append(p.cidrs, cidrRule{allow: allow, prefix: pfx.Masked(), text: text})
+		return nil
+	}
+	if ip, err := netip.ParseAddr(value); err == nil {
+		p.cidrs = append(p.cidrs, cidrRule{allow: allow, prefix: netip.PrefixFrom(ip, ip.BitLen()), text: text})
+		return nil
+	}
+
+	rule := domainRule{allow: allow, text: text}
+	if strings.HasPrefix(value, "*.") {
+		rule.wildcard = true
+		value = value[2:]
+	}
+	suffix, err := canonicalHost(value)
+	if err != nil || suffix == "" || strings.ContainsAny(suffix, "*/:") {
+		return fmt.Errorf("invalid host pattern %q", fields[1])
+	}
+	rule.suffix = suffix
+	p.domains = append(p.domains, rule)
+	return nil
+}
+
+// CheckURL проверяет хост адреса. Адрес без хоста не разрешается.
+func (p *Policy) CheckURL(rawURL string) Decision {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return Decision{Allowed: false, Rule: "invalid url"}
+	}
+	return p.Check(u.Hostname())
+}
+
+// Check проверяет имя хоста или IP-адрес.
+func (p *Policy) Check(host string) Decision {
+	if ip, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return p.checkIP(ip.WithZone("").Unmap())
+	}
+
+	host, err := canonicalHost(host)
+	if err != nil {
+		return Decision{Allowed: false, Rule: "invalid host"}
+	}
+
+	var best *domainRule
+	bestScore := -1
+	for i := range p.domains {
+		r := &p.domains[i]
+		score, ok := r.match(host)
+		if !ok {
+			continue
+		}
+		if score > bestScore || (score == bestScore && !r.allow) {
+			best, bestScore = r, score
+		}
+	}
+	if best == nil {
+		return Decision{Allowed: p.defaultAllow}
+	}
+	return Decision{Allowed: best.allow, Rule: best.text}
+}
+
+func (p *Policy) checkIP(ip netip.Addr) Decision {
+	var best *cidrRule
+	for i := range p.cidrs {
+		r := &p.cidrs[i]
+		if !r.prefix.Contains(ip) {
+			continue
+		}
+		if best == nil || r.prefix.Bits() > best.prefix.Bits() ||
+			(r.prefix.Bits() == best.prefix.Bits() && !r.allow) {
+			best = r
+		}
+	}
+	if best == nil {
+		return Decision{Allowed: p.defaultAllow}
+	}
+	return Decision{Allowed: best.allow, Rule: best.text}
+}
+
+// match сообщает, подходит ли правило к хосту, и его точность.
+func (r *domainRule) match(host string) (int, bool) {
+	labels := 2 * (strings.Count(r.suffix, ".") + 1)
+	if r.wildcard {
+		return labels, strings.HasSuffix(host, "."+r.suffix)
+	}
+	return labels + 1, host == r.suffix
+}
+
+// canonicalHost приводит имя к виду, в котором хранятся правила: нижний
+// регистр, punycode, без завершающей точки.
+func canonicalHost(host string) (string, error) {
+	return punycode.ToASCII(strings.TrimSuffix(host, "."))
+}
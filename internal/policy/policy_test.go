@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	p, err := Parse(strings.NewReader(`
+# вредоносные домены
+deny  *.malware.example
+allow good.malware.example
+deny  evil.example
+deny  203.0.113.0/24
+allow 10.1.2.3        # внутренний сервис, на который можно ссылаться
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	for host, want := range map[string]bool{
+		"example.com":            true,
+		"malware.example":        true, // шаблон — только поддомены
+		"a.malware.example":      false,
+		"a.b.MALWARE.example.":   false,
+		"good.malware.example":   true,
+		"x.good.malware.example": false,
+		"evil.example":           false,
+		"sub.evil.example":       true,
+		"203.0.113.7":            false,
+		"198.51.100.1":           true,
+		"127.0.0.1":              false,
+		"::1":                    false,
+		"::ffff:192.168.1.1":     false,
+		"fe80::1%eth0":           false,
+		"10.0.0.1":               false,
+		"10.1.2.3":               true,
+		"localhost":              false,
+		"api.localhost":          false,
+		"xn--bcher-kva.example":  true,
+	} {
+		if got := p.Check(host); got.Allowed != want {
+			t.Errorf("Check(%q) = %+v, want allowed=%t", host, got, want)
+		}
+	}
+
+	if d := p.CheckURL("https://a.malware.example/x"); d.Allowed || d.Rule != "deny *.malware.example" {
+		t.Errorf("CheckURL = %+v, want denied by wildcard rule", d)
+	}
+}
+
+func TestDefaultDeny(t *testing.T) {
+	p, err := Parse(strings.NewReader("default deny\nallow *.example.com\nallow пример.рф"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	for host, want := range map[string]bool{
+		"www.example.com":       true,
+		"example.org":           false,
+		"8.8.8.8":               false,
+		"xn--e1afmkfd.xn--p1ai": true,
+	} {
+		if got := p.Check(host).Allowed; got != want {
+			t.Errorf("Check(%q) = %t, want %t", host, got, want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{"block evil.example", "deny", "default maybe", "deny *.*.example", "deny a/b"} {
+		if _, err := Parse(strings.NewReader(src)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", src)
+		}
+	}
+}
+
+func TestEngineReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	if err := os.WriteFile(path, []byte("deny evil.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewEngine(path)
+	if err != nil {
+		t.Fatalf("new engine: %v", err)
+	}
+	if e.CheckURL("https://evil.example/").Allowed {
+		t.Fatal("evil.example allowed before reload")
+	}
+
+	if err := os.WriteFile(path, []byte("deny other.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if !e.CheckURL("https://evil.example/").Allowed || e.CheckURL("https://other.example/").Allowed {
+		t.Fatal("reload did not replace the rules")
+	}
+
+	// битый файл не сбрасывает действующие правила
+	if err := os.WriteFile(path, []byte("nonsense\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Reload(); err == nil {
+		t.Fatal("reload of invalid file succeeded")
+	}
+	if e.CheckURL("https://other.example/").Allowed {
+		t.Fatal("failed reload dropped the previous rules")
+	}
+}
@@ -0,0 +1,151 @@
+// Package punycode переводит интернационализированные доменные имена в
+// ASCII-вид (RFC 3492, префикс xn--). Полная обработка IDNA (UTS #46 с
+// нормализацией Unicode) не выполняется: метки только приводятся к нижнему
+// регистру, этого достаточно для единообразного хранения адресов.
+package punycode
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	base        = 36
+	tMin        = 1
+	tMax        = 26
+	skew        = 38
+	damp        = 700
+	initialBias = 72
+	initialN    = 128
+
+	acePrefix = "xn--"
+)
+
+var ErrInvalid = errors.New("punycode: invalid input")
+
+// ToASCII переводит доменное имя в ASCII: метки с не-ASCII символами
+// кодируются в xn--…, остальные приводятся к нижнему регистру.
+func ToASCII(host string) (string, error) {
+	if !utf8.ValidString(host) {
+		return "", ErrInvalid
+	}
+	labels := strings.Split(host, ".")
+	for i, l := range labels {
+		l = strings.ToLower(l)
+		if isASCII(l) {
+			labels[i] = l
+			continue
+		}
+		enc, err := Encode(l)
+		if err != nil {
+			return "", err
+		}
+		labels[i] = acePrefix + enc
+	}
+	return strings.Join(labels, "."), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Encode кодирует одну метку по RFC 3492 (без префикса xn--).
+func Encode(s string) (string, error) {
+	runes := []rune(s)
+	out := make([]byte, 0, len(s)+8)
+
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := rune(initialN), 0, initialBias
+	for handled < len(runes) {
+		// наименьший ещё не обработанный символ
+		m := rune(0x7fffffff)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		if int(m-n) > (maxInt-delta)/(handled+1) {
+			return "", ErrInvalid
+		}
+		delta += int(m-n) * (handled + 1)
+		n = m
+
+		for _, r := range runes {
+			if r < n {
+				delta++
+				if delta == maxInt {
+					return "", ErrInvalid
+				}
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := base; ; k += base {
+				t := threshold(k, bias)
+				if q < t {
+					break
+				}
+				out = append(out, digit(t+(q-t)%(base-t)))
+				q = (q - t) / (base - t)
+			}
+			out = append(out, digit(q))
+			bias = adapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(out), nil
+}
+
+const maxInt = int(^uint32(0) >> 1)
+
+func threshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return tMin
+	case k >= bias+tMax:
+		return tMax
+	}
+	return k - bias
+}
+
+func adapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= damp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((base-tMin)*tMax)/2 {
+		delta /= base - tMin
+		k += base
+	}
+	return k + (base-tMin+1)*delta/(delta+skew)
+}
+
+func digit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
@@ -0,0 +1,22 @@
+package punycode
+
+import "testing"
+
+func TestToASCII(t *testing.T) {
+	for in, want := range map[string]string{
+		"bücher.example":   "xn--bcher-kva.example",
+		"München.DE":       "xn--mnchen-3ya.de",
+		"пример.рф":        "xn--e1afmkfd.xn--p1ai",
+		"例え.テスト":           "xn--r8jz45g.xn--zckzah",
+		"Example.COM":      "example.com",
+		"xn--bcher-kva.ch": "xn--bcher-kva.ch",
+	} {
+		got, err := ToASCII(in)
+		if err != nil {
+			t.Fatalf("ToASCII(%q): %v", in, err)
+		}
+		if got != want {
+			t.Errorf("ToASCII(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"shortener/internal/domain"
+	"shortener/internal/hll"
+)
+
+var _ domain.AnalyticsRepository = (*AnalyticsRepository)(nil)
+
+type sketchKey struct {
+	code string
+	day  int64 // начало суток, секунды Unix
+}
+
+type AnalyticsRepository struct {
+	mu       sync.RWMutex
+	events   map[string][]domain.ClickEvent
+	sketches map[sketchKey]*hll.Sketch
+	salt     []byte
+}
+
+func NewAnalytics() *AnalyticsRepository {
+	return &AnalyticsRepository{
+		events:   make(map[string][]domain.ClickEvent),
+		sketches: make(map[sketchKey]*hll.Sketch),
+	}
+}
+
+func (r *AnalyticsRepository) Migrate(ctx context.Context) error {
+	return nil
+}
+
+// IPHashSalt живёт, как и вся аналитика в памяти, до перезапуска.
+func (r *AnalyticsRepository) IPHashSalt(ctx context.Context, candidate []byte) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.salt == nil {
+		r.salt = append([]byte(nil), candidate...)
+	}
+	return r.salt, nil
+}
+
+func (r *AnalyticsRepository) SaveClicks(ctx context.Context, events []domain.ClickEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, ev := range events {
+		r.events[ev.Code] = append(r.events[ev.Code], ev)
+	}
+	return nil
+}
+
+func (r *AnalyticsRepository) ClickStats(ctx context.Context, code string, from, to time.Time, top int) (*domain.LinkStats, error) {
+	hourly := make(map[int64]int64)
+	daily := make(map[int64]int64)
+	referrers := make(map[string]int64)
+	browsers := make(map[string]int64)
+
+	st := &domain.LinkStats{Code: code, From: from, To: to}
+
+	r.mu.RLock()
+	for _, ev := range r.events[code] {
+		if ev.At.Before(from) || !ev.At.Before(to) {
+			continue
+		}
+		st.TotalClicks++
+		sec := ev.At.Unix()
+		hourly[sec-sec%3600]++
+		daily[sec-sec%86400]++
+		if ev.ReferrerHost != "" {
+			referrers[ev.ReferrerHost]++
+		}
+		if ev.Browser != "" {
+			browsers[ev.Browser]++
+		}
+	}
+	r.mu.RUnlock()
+
+	st.Hourly = toBuckets(hourly)
+	st.Daily = toBuckets(daily)
+	st.TopReferrers = topN(referrers, top)
+	st.TopBrowsers = topN(browsers, top)
+	return st, nil
+}
+
+func (r *AnalyticsRepository) MergeSketches(ctx context.Context, sketches []domain.DailySketch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, ds := range sketches {
+		sk, err := hll.Decode(ds.Sketch)
+		if err != nil {
+			return err
+		}
+		key := sketchKey{code: ds.Code, day: ds.Day.Unix()}
+		if cur, ok := r.sketches[key]; ok {
+			if err := cur.Merge(sk); err != nil {
+				return err
+			}
+			continue
+		}
+		r.sketches[key] = sk
+	}
+	return nil
+}
+
+func (r *AnalyticsRepository) Sketches(ctx context.Context, code string, from, to time.Time) ([]domain.DailySketch, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var out []domain.DailySketch
+	for key, sk := range r.sketches {
+		if key.code != code || key.day+86400 <= from.Unix() || key.day >= to.Unix() {
+			continue
+		}
+		data, err := sk.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, domain.DailySketch{Code: code, Day: time.Unix(key.day, 0).UTC(), Sketch: data})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Day.Before(out[j].Day) })
+	return out, nil
+}
+
+func toBuckets(m map[int64]int64) []domain.StatsBucket {
+	out := make([]domain.StatsBucket, 0, len(m))
+	for start, n := range m {
+		out = append(out, domain.StatsBucket{Start: time.Unix(start, 0).UTC(), Clicks: n})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
+
+func topN(m map[string]int64, n int) []domain.CountEntry {
+	out := make([]domain.CountEntry, 0, len(m))
+	for k, c := range m {
+		out = append(out, domain.CountEntry{Key: k, Count: c})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Key < out[j].Key
+	})
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
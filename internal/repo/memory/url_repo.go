@@ -2,6 +2,7 @@ package memory
 
 import (
 	"context"
+	"sort"
 	"sync"
 	"time"
 
@@ -13,11 +14,14 @@ var _ domain.URLRepository = (*URLRepository)(nil)
 type URLRepository struct {
 	mu   sync.RWMutex
 	urls map[string]*domain.URL
+	// byHash — вторичный индекс для дедупликации: URLHash адреса → коды
+	byHash map[string]map[string]struct{}
 }
 
 func New() *URLRepository {
 	return &URLRepository{
-		urls: make(map[string]*domain.URL),
+		urls:   make(map[string]*domain.URL),
+		byHash: make(map[string]map[string]struct{}),
 	}
 }
 
@@ -25,7 +29,7 @@ func (r *URLRepository) Migrate(ctx context.Context) error {
 	return nil
 }
 
-func (r *URLRepository) Create(ctx context.Context, code, originalURL string, expiresAt *time.Time) error {
+func (r *URLRepository) Create(ctx context.Context, code, originalURL string, expiresAt *time.Time, redirectStatus int) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -40,10 +44,51 @@ func (r *URLRepository) Create(ctx context.Context, code, originalURL string, ex
 		CreatedAt:   now,
 		ExpiresAt:   expiresAt,
 		ClickCount:  0,
+		Version:     1,
+
+		RedirectStatus: redirectStatus,
 	}
+	r.index(code, originalURL)
 	return nil
 }
 
+func (r *URLRepository) index(code, originalURL string) {
+	h := domain.URLHash(originalURL)
+	codes, ok := r.byHash[h]
+	if !ok {
+		codes = make(map[string]struct{})
+		r.byHash[h] = codes
+	}
+	codes[code] = struct{}{}
+}
+
+func (r *URLRepository) unindex(code, originalURL string) {
+	h := domain.URLHash(originalURL)
+	if codes, ok := r.byHash[h]; ok {
+		delete(codes, code)
+		if len(codes) == 0 {
+			delete(r.byHash, h)
+		}
+	}
+}
+
+func (r *URLRepository) FindByURLHash(ctx context.Context, hash string) ([]domain.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	var out []domain.URL
+	for code := range r.byHash[hash] {
+		u := r.urls[code]
+		if u.Disabled || (u.ExpiresAt != nil && now.After(*u.ExpiresAt)) {
+			continue
+		}
+		out = append(out, *u)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
 func (r *URLRepository) GetByCode(ctx context.Context, code string) (*domain.URL, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -54,9 +99,101 @@ func (r *URLRepository) GetByCode(ctx context.Context, code string) (*domain.URL
 	}
 
 	if u.ExpiresAt != nil && time.Now().After(*u.ExpiresAt) {
-		return nil, domain.ErrURLNotFound
+		return nil, domain.ErrURLExpired
 	}
 
 	cp := *u
 	return &cp, nil
 }
+
+func (r *URLRepository) Delete(ctx context.Context, code string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.urls[code]
+	if !ok {
+		return domain.ErrURLNotFound
+	}
+	r.unindex(code, u.OriginalURL)
+	delete(r.urls, code)
+	return nil
+}
+
+func (r *URLRepository) Disable(ctx context.Context, code, reason string) error {
+	return r.setDisabled(code, true, reason)
+}
+
+func (r *URLRepository) Enable(ctx context.Context, code string) error {
+	return r.setDisabled(code, false, "")
+}
+
+func (r *URLRepository) setDisabled(code string, disabled bool, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.urls[code]
+	if !ok {
+		return domain.ErrURLNotFound
+	}
+	u.Disabled = disabled
+	u.DisabledReason = reason
+	u.Version++
+	return nil
+}
+
+func (r *URLRepository) Update(ctx context.Context, code string, upd domain.LinkUpdate, ifVersion int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.urls[code]
+	if !ok {
+		return domain.ErrURLNotFound
+	}
+	if ifVersion != 0 && u.Version != ifVersion {
+		return domain.ErrVersionConflict
+	}
+	if upd.OriginalURL != nil {
+		r.unindex(code, u.OriginalURL)
+		u.OriginalURL = *upd.OriginalURL
+		r.index(code, u.OriginalURL)
+	}
+	if upd.Disabled != nil {
+		u.Disabled = *upd.Disabled
+		u.DisabledReason = ""
+		if u.Disabled {
+			u.DisabledReason = upd.DisabledReason
+		}
+	}
+	u.Version++
+	return nil
+}
+
+func (r *URLRepository) IncrementClicks(ctx context.Context, deltas map[string]int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for code, n := range deltas {
+		if u, ok := r.urls[code]; ok {
+			u.ClickCount += n
+		}
+	}
+	return nil
+}
+
+func (r *URLRepository) CreateBatch(ctx context.Context, urls []domain.URL) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var skipped []string
+	for _, u := range urls {
+		if _, exists := r.urls[u.Code]; exists {
+			skipped = append(skipped, u.Code)
+			continue
+		}
+		cp := u
+		cp.Version = 1
+		r.urls[u.Code] = &cp
+		r.index(u.Code, u.OriginalURL)
+	}
+	return skipped, nil
+}
@@ -0,0 +1,245 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"shortener/internal/domain"
+	"shortener/internal/hll"
+)
+
+var _ domain.AnalyticsRepository = (*AnalyticsRepository)(nil)
+
+type AnalyticsRepository struct {
+	db *sql.DB
+}
+
+func NewAnalytics(db *sql.DB) *AnalyticsRepository {
+	return &AnalyticsRepository{db: db}
+}
+
+// Время перехода хранится в секундах Unix, чтобы бакеты считались целочисленным делением.
+func (r *AnalyticsRepository) Migrate(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS click_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL,
+    at INTEGER NOT NULL,
+    referrer_host TEXT NOT NULL DEFAULT '',
+    browser TEXT NOT NULL DEFAULT '',
+    language TEXT NOT NULL DEFAULT '',
+    ip_hash TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_click_events_code_at ON click_events(code, at);
+
+CREATE TABLE IF NOT EXISTS unique_sketches (
+    code TEXT NOT NULL,
+    day INTEGER NOT NULL,
+    sketch BLOB NOT NULL,
+    PRIMARY KEY (code, day)
+);
+
+CREATE TABLE IF NOT EXISTS analytics_settings (
+    key TEXT PRIMARY KEY,
+    value BLOB NOT NULL
+);
+`)
+	return err
+}
+
+// IPHashSalt сохраняет candidate, только если соли ещё нет: из нескольких
+// одновременно стартующих экземпляров все получат соль первого.
+func (r *AnalyticsRepository) IPHashSalt(ctx context.Context, candidate []byte) ([]byte, error) {
+	if _, err := r.db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO analytics_settings(key, value) VALUES('ip_hash_salt', ?)`, candidate); err != nil {
+		return nil, err
+	}
+	var salt []byte
+	if err := r.db.QueryRowContext(ctx,
+		`SELECT value FROM analytics_settings WHERE key = 'ip_hash_salt'`).Scan(&salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+func (r *AnalyticsRepository) SaveClicks(ctx context.Context, events []domain.ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO click_events(code, at, referrer_host, browser, language, ip_hash)
+VALUES(?,?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, ev := range events {
+		if _, err := stmt.ExecContext(ctx,
+			ev.Code, ev.At.Unix(), ev.ReferrerHost, ev.Browser, ev.Language, ev.IPHash,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *AnalyticsRepository) ClickStats(ctx context.Context, code string, from, to time.Time, top int) (*domain.LinkStats, error) {
+	st := &domain.LinkStats{Code: code, From: from, To: to}
+	args := []any{code, from.Unix(), to.Unix()}
+
+	var err error
+	if st.Hourly, err = r.buckets(ctx, 3600, args); err != nil {
+		return nil, err
+	}
+	if st.Daily, err = r.buckets(ctx, 86400, args); err != nil {
+		return nil, err
+	}
+	for _, b := range st.Daily {
+		st.TotalClicks += b.Clicks
+	}
+
+	if st.TopReferrers, err = r.top(ctx, "referrer_host", top, args); err != nil {
+		return nil, err
+	}
+	if st.TopBrowsers, err = r.top(ctx, "browser", top, args); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// MergeSketches читает сохранённый скетч, объединяет с новым и пишет обратно в одной транзакции.
+func (r *AnalyticsRepository) MergeSketches(ctx context.Context, sketches []domain.DailySketch) error {
+	if len(sketches) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, ds := range sketches {
+		sk, err := hll.Decode(ds.Sketch)
+		if err != nil {
+			return err
+		}
+
+		var stored []byte
+		err = tx.QueryRowContext(ctx,
+			`SELECT sketch FROM unique_sketches WHERE code = ? AND day = ?`,
+			ds.Code, ds.Day.Unix(),
+		).Scan(&stored)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return err
+		default:
+			cur, err := hll.Decode(stored)
+			if err != nil {
+				return err
+			}
+			if err := sk.Merge(cur); err != nil {
+				return err
+			}
+		}
+
+		data, err := sk.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO unique_sketches(code, day, sketch) VALUES(?,?,?)
+ON CONFLICT(code, day) DO UPDATE SET sketch = excluded.sketch;
+`, ds.Code, ds.Day.Unix(), data); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *AnalyticsRepository) Sketches(ctx context.Context, code string, from, to time.Time) ([]domain.DailySketch, error) {
+	rows, err := r.db.QueryContext(ctx, `
+SELECT day, sketch
+FROM unique_sketches
+WHERE code = ? AND day > ? AND day < ?
+ORDER BY day;
+`, code, from.Unix()-86400, to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []domain.DailySketch
+	for rows.Next() {
+		var day int64
+		ds := domain.DailySketch{Code: code}
+		if err := rows.Scan(&day, &ds.Sketch); err != nil {
+			return nil, err
+		}
+		ds.Day = time.Unix(day, 0).UTC()
+		out = append(out, ds)
+	}
+	return out, rows.Err()
+}
+
+func (r *AnalyticsRepository) buckets(ctx context.Context, size int64, args []any) ([]domain.StatsBucket, error) {
+	rows, err := r.db.QueryContext(ctx, `
+SELECT at - at % ? AS bucket, COUNT(*)
+FROM click_events
+WHERE code = ? AND at >= ? AND at < ?
+GROUP BY bucket
+ORDER BY bucket;
+`, append([]any{size}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []domain.StatsBucket
+	for rows.Next() {
+		var start, n int64
+		if err := rows.Scan(&start, &n); err != nil {
+			return nil, err
+		}
+		out = append(out, domain.StatsBucket{Start: time.Unix(start, 0).UTC(), Clicks: n})
+	}
+	return out, rows.Err()
+}
+
+// top считает топ значений колонки; column подставляется только из констант выше.
+func (r *AnalyticsRepository) top(ctx context.Context, column string, limit int, args []any) ([]domain.CountEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+SELECT `+column+`, COUNT(*) AS n
+FROM click_events
+WHERE code = ? AND at >= ? AND at < ? AND `+column+` != ''
+GROUP BY 1
+ORDER BY n DESC, 1
+LIMIT ?;
+`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []domain.CountEntry
+	for rows.Next() {
+		var e domain.CountEntry
+		if err := rows.Scan(&e.Key, &e.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
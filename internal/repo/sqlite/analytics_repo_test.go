@@ -0,0 +1,145 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"shortener/internal/domain"
+	"shortener/internal/hll"
+)
+
+func openAnalytics(t *testing.T, path string) *AnalyticsRepository {
+	t.Helper()
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	r := NewAnalytics(db)
+	if err := r.Migrate(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return r
+}
+
+func TestIPHashSaltPersists(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "shortener.db")
+
+	salt, err := openAnalytics(t, path).IPHashSalt(ctx, []byte("first"))
+	if err != nil || string(salt) != "first" {
+		t.Fatalf("salt = %q, %v, want first", salt, err)
+	}
+
+	// после перезапуска новая случайная соль не заменяет сохранённую
+	again, err := openAnalytics(t, path).IPHashSalt(ctx, []byte("second"))
+	if err != nil || !bytes.Equal(again, salt) {
+		t.Fatalf("salt after reopen = %q, %v, want %q", again, err, salt)
+	}
+}
+
+func TestClickStats(t *testing.T) {
+	ctx := context.Background()
+	r := openAnalytics(t, filepath.Join(t.TempDir(), "shortener.db"))
+
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	click := func(code string, at time.Time, ref, browser string) domain.ClickEvent {
+		return domain.ClickEvent{Code: code, At: at, Visitor: domain.Visitor{ReferrerHost: ref, Browser: browser}}
+	}
+	if err := r.SaveClicks(ctx, []domain.ClickEvent{
+		click("abc", day.Add(10*time.Minute), "news.example", "chrome"),
+		click("abc", day.Add(50*time.Minute), "news.example", "firefox"),
+		click("abc", day.Add(2*time.Hour), "", "chrome"),
+		click("abc", day.Add(26*time.Hour), "blog.example", "chrome"),
+		click("abc", day.Add(-time.Minute), "news.example", "chrome"), // до периода
+		click("xyz", day.Add(time.Hour), "news.example", "chrome"),    // другая ссылка
+	}); err != nil {
+		t.Fatalf("save clicks: %v", err)
+	}
+
+	st, err := r.ClickStats(ctx, "abc", day, day.Add(48*time.Hour), 1)
+	if err != nil {
+		t.Fatalf("click stats: %v", err)
+	}
+	if st.TotalClicks != 4 {
+		t.Fatalf("total = %d, want 4", st.TotalClicks)
+	}
+	wantHourly := []domain.StatsBucket{
+		{Start: day, Clicks: 2},
+		{Start: day.Add(2 * time.Hour), Clicks: 1},
+		{Start: day.Add(26 * time.Hour), Clicks: 1},
+	}
+	if len(st.Hourly) != len(wantHourly) {
+		t.Fatalf("hourly = %+v, want %+v", st.Hourly, wantHourly)
+	}
+	for i, b := range st.Hourly {
+		if !b.Start.Equal(wantHourly[i].Start) || b.Clicks != wantHourly[i].Clicks {
+			t.Fatalf("hourly[%d] = %+v, want %+v", i, b, wantHourly[i])
+		}
+	}
+	if len(st.Daily) != 2 || st.Daily[0].Clicks != 3 || st.Daily[1].Clicks != 1 {
+		t.Fatalf("daily = %+v, want 3 and 1 clicks", st.Daily)
+	}
+	// пустой реферер в топ не попадает, top ограничивает длину
+	if len(st.TopReferrers) != 1 || st.TopReferrers[0] != (domain.CountEntry{Key: "news.example", Count: 2}) {
+		t.Fatalf("top referrers = %+v, want news.example: 2", st.TopReferrers)
+	}
+	if len(st.TopBrowsers) != 1 || st.TopBrowsers[0] != (domain.CountEntry{Key: "chrome", Count: 3}) {
+		t.Fatalf("top browsers = %+v, want chrome: 3", st.TopBrowsers)
+	}
+}
+
+func TestMergeSketches(t *testing.T) {
+	ctx := context.Background()
+	r := openAnalytics(t, filepath.Join(t.TempDir(), "shortener.db"))
+
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	sketch := func(from, to uint64) []byte {
+		sk := hll.New(hll.DefaultPrecision)
+		for i := from; i < to; i++ {
+			sum := sha256.Sum256([]byte(strconv.FormatUint(i, 10)))
+			sk.Add(binary.BigEndian.Uint64(sum[:8]))
+		}
+		data, err := sk.MarshalBinary()
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		return data
+	}
+
+	// два сброса за одни сутки объединяются, а не перезаписывают друг друга
+	for _, batch := range [][]domain.DailySketch{
+		{{Code: "abc", Day: day, Sketch: sketch(0, 100)}, {Code: "abc", Day: day.Add(24 * time.Hour), Sketch: sketch(0, 10)}},
+		{{Code: "abc", Day: day, Sketch: sketch(50, 200)}},
+	} {
+		if err := r.MergeSketches(ctx, batch); err != nil {
+			t.Fatalf("merge: %v", err)
+		}
+	}
+
+	got, err := r.Sketches(ctx, "abc", day.Add(time.Hour), day.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("sketches: %v", err)
+	}
+	if len(got) != 1 || !got[0].Day.Equal(day) {
+		t.Fatalf("sketches = %+v, want only the day covering the period", got)
+	}
+	sk, err := hll.Decode(got[0].Sketch)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if est := sk.Estimate(); est < 180 || est > 220 {
+		t.Fatalf("estimate = %d, want about 200", est)
+	}
+
+	if all, err := r.Sketches(ctx, "abc", day, day.Add(48*time.Hour)); err != nil || len(all) != 2 {
+		t.Fatalf("sketches for two days = %d, %v, want 2", len(all), err)
+	}
+}
@@ -61,13 +61,76 @@ CREATE TABLE IF NOT EXISTS urls (
 
 CREATE INDEX IF NOT EXISTS idx_urls_code ON urls(code);
 `)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Колонки, добавленные после первой версии схемы: для существующих БД дописываем через ALTER TABLE.
+	for _, c := range []struct{ name, ddl string }{
+		{"disabled", "disabled INTEGER NOT NULL DEFAULT 0"},
+		{"disabled_reason", "disabled_reason TEXT NOT NULL DEFAULT ''"},
+		{"version", "version INTEGER NOT NULL DEFAULT 1"},
+		{"url_hash", "url_hash TEXT NOT NULL DEFAULT ''"},
+		{"redirect_status", "redirect_status INTEGER NOT NULL DEFAULT 0"},
+	} {
+		if err := addColumnIfMissing(ctx, r.db, "urls", c.name, c.ddl); err != nil {
+			return err
+		}
+	}
+
+	if _, err := r.db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_urls_url_hash ON urls(url_hash);`); err != nil {
+		return err
+	}
+	return r.backfillURLHashes(ctx)
+}
+
+// backfillURLHashes считает url_hash для строк, созданных до появления колонки.
+func (r *URLRepository) backfillURLHashes(ctx context.Context) error {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, original_url FROM urls WHERE url_hash = ''`)
+	if err != nil {
+		return err
+	}
+	hashes := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var u string
+		if err := rows.Scan(&id, &u); err != nil {
+			rows.Close()
+			return err
+		}
+		hashes[id] = domain.URLHash(u)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `UPDATE urls SET url_hash = ? WHERE id = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for id, h := range hashes {
+		if _, err := stmt.ExecContext(ctx, h, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
-func (r *URLRepository) Create(ctx context.Context, code, originalURL string, expiresAt *time.Time) error {
+func (r *URLRepository) Create(ctx context.Context, code, originalURL string, expiresAt *time.Time, redirectStatus int) error {
 	_, err := r.db.ExecContext(ctx,
-		`INSERT INTO urls(code, original_url, expires_at) VALUES(?,?,?)`,
-		code, originalURL, expiresAt,
+		`INSERT INTO urls(code, original_url, expires_at, url_hash, redirect_status) VALUES(?,?,?,?,?)`,
+		code, originalURL, expiresAt, domain.URLHash(originalURL), redirectStatus,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -82,7 +145,7 @@ func (r *URLRepository) Create(ctx context.Context, code, originalURL string, ex
 
 func (r *URLRepository) GetByCode(ctx context.Context, code string) (*domain.URL, error) {
 	row := r.db.QueryRowContext(ctx, `
-SELECT code, original_url, created_at, expires_at, click_count
+SELECT code, original_url, created_at, expires_at, click_count, disabled, disabled_reason, version, redirect_status
 FROM urls
 WHERE code = ?;
 `, code)
@@ -90,7 +153,7 @@ WHERE code = ?;
 	var u domain.URL
 	var expires sql.NullTime
 
-	if err := row.Scan(&u.Code, &u.OriginalURL, &u.CreatedAt, &expires, &u.ClickCount); err != nil {
+	if err := row.Scan(&u.Code, &u.OriginalURL, &u.CreatedAt, &expires, &u.ClickCount, &u.Disabled, &u.DisabledReason, &u.Version, &u.RedirectStatus); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, domain.ErrURLNotFound
 		}
@@ -102,12 +165,197 @@ WHERE code = ?;
 	}
 
 	if u.ExpiresAt != nil && time.Now().After(*u.ExpiresAt) {
-		return nil, domain.ErrURLNotFound
+		return nil, domain.ErrURLExpired
 	}
 
 	return &u, nil
 }
 
+func (r *URLRepository) FindByURLHash(ctx context.Context, hash string) ([]domain.URL, error) {
+	// срок и отключение проверяем в Go: строк с одним хэшем обычно единицы
+	rows, err := r.db.QueryContext(ctx, `
+SELECT code, original_url, created_at, expires_at, click_count, disabled, disabled_reason, version, redirect_status
+FROM urls
+WHERE url_hash = ? AND disabled = 0
+ORDER BY id DESC;
+`, hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var out []domain.URL
+	for rows.Next() {
+		var u domain.URL
+		var expires sql.NullTime
+		if err := rows.Scan(&u.Code, &u.OriginalURL, &u.CreatedAt, &expires, &u.ClickCount, &u.Disabled, &u.DisabledReason, &u.Version, &u.RedirectStatus); err != nil {
+			return nil, err
+		}
+		if expires.Valid {
+			if now.After(expires.Time) {
+				continue
+			}
+			u.ExpiresAt = &expires.Time
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+func (r *URLRepository) Delete(ctx context.Context, code string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM urls WHERE code = ?`, code)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *URLRepository) Disable(ctx context.Context, code, reason string) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE urls SET disabled = 1, disabled_reason = ?, version = version + 1 WHERE code = ?`,
+		reason, code,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *URLRepository) Enable(ctx context.Context, code string) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE urls SET disabled = 0, disabled_reason = '', version = version + 1 WHERE code = ?`,
+		code,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (r *URLRepository) Update(ctx context.Context, code string, upd domain.LinkUpdate, ifVersion int64) error {
+	// NULL — поле не меняется; всё изменение и проверка версии — один UPDATE
+	var originalURL, urlHash, reason sql.NullString
+	var disabled sql.NullBool
+	if upd.OriginalURL != nil {
+		originalURL = sql.NullString{String: *upd.OriginalURL, Valid: true}
+		urlHash = sql.NullString{String: domain.URLHash(*upd.OriginalURL), Valid: true}
+	}
+	if upd.Disabled != nil {
+		disabled = sql.NullBool{Bool: *upd.Disabled, Valid: true}
+		reason.Valid = true
+		if *upd.Disabled {
+			reason.String = upd.DisabledReason
+		}
+	}
+
+	res, err := r.db.ExecContext(ctx, `
+UPDATE urls SET
+    original_url = COALESCE(?, original_url),
+    url_hash = COALESCE(?, url_hash),
+    disabled = COALESCE(?, disabled),
+    disabled_reason = COALESCE(?, disabled_reason),
+    version = version + 1
+WHERE code = ? AND (? = 0 OR version = ?);
+`, originalURL, urlHash, disabled, reason, code, ifVersion, ifVersion)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	// строка не обновлена: либо её нет, либо версия уже другая
+	var exists int
+	err = r.db.QueryRowContext(ctx, `SELECT 1 FROM urls WHERE code = ?`, code).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrURLNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return domain.ErrVersionConflict
+}
+
+func (r *URLRepository) IncrementClicks(ctx context.Context, deltas map[string]int64) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `UPDATE urls SET click_count = click_count + ? WHERE code = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for code, n := range deltas {
+		if _, err := stmt.ExecContext(ctx, n, code); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *URLRepository) CreateBatch(ctx context.Context, urls []domain.URL) ([]string, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT OR IGNORE INTO urls(code, original_url, created_at, expires_at, url_hash, redirect_status) VALUES(?,?,?,?,?,?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var skipped []string
+	for _, u := range urls {
+		res, err := stmt.ExecContext(ctx, u.Code, u.OriginalURL, u.CreatedAt.UTC(), u.ExpiresAt, domain.URLHash(u.OriginalURL), u.RedirectStatus)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 0 {
+			skipped = append(skipped, u.Code)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
+
+// expectAffected превращает «ни одна строка не затронута» в ErrURLNotFound.
+func expectAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrURLNotFound
+	}
+	return nil
+}
+
 func sqliteIsUniqueViolation(err error) bool {
 	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
 }
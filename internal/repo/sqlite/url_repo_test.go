@@ -0,0 +1,250 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"shortener/internal/domain"
+)
+
+func openURLs(t *testing.T) *URLRepository {
+	t.Helper()
+	db, err := Open(filepath.Join(t.TempDir(), "shortener.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	r := New(db)
+	if err := r.Migrate(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return r
+}
+
+func TestDisableEnableDelete(t *testing.T) {
+	ctx := context.Background()
+	r := openURLs(t)
+
+	if err := r.Create(ctx, "abc", "https://example.com/", nil, 0); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	if err := r.Disable(ctx, "abc", "phishing"); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	u, err := r.GetByCode(ctx, "abc")
+	if err != nil || !u.Disabled || u.DisabledReason != "phishing" || u.Version != 2 {
+		t.Fatalf("after disable = %+v, %v, want disabled with reason at version 2", u, err)
+	}
+
+	if err := r.Enable(ctx, "abc"); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	u, err = r.GetByCode(ctx, "abc")
+	if err != nil || u.Disabled || u.DisabledReason != "" || u.Version != 3 {
+		t.Fatalf("after enable = %+v, %v, want enabled without reason at version 3", u, err)
+	}
+
+	if err := r.Delete(ctx, "abc"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := r.GetByCode(ctx, "abc"); !errors.Is(err, domain.ErrURLNotFound) {
+		t.Fatalf("get after delete: err = %v, want ErrURLNotFound", err)
+	}
+
+	for name, op := range map[string]func() error{
+		"delete":  func() error { return r.Delete(ctx, "abc") },
+		"disable": func() error { return r.Disable(ctx, "abc", "") },
+		"enable":  func() error { return r.Enable(ctx, "abc") },
+	} {
+		if err := op(); !errors.Is(err, domain.ErrURLNotFound) {
+			t.Errorf("%s missing code: err = %v, want ErrURLNotFound", name, err)
+		}
+	}
+}
+
+func TestMigrateLegacySchema(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(filepath.Join(t.TempDir(), "legacy.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+
+	// таблица первой версии, без колонок, добавленных позже
+	if _, err := db.ExecContext(ctx, `
+CREATE TABLE urls (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL UNIQUE,
+    original_url TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    expires_at DATETIME NULL,
+    click_count INTEGER NOT NULL DEFAULT 0
+);
+INSERT INTO urls(code, original_url, click_count) VALUES('old', 'https://example.com/old', 7);
+`); err != nil {
+		t.Fatalf("create legacy schema: %v", err)
+	}
+
+	r := New(db)
+	for i := range 2 {
+		// миграция повторяется при каждом старте
+		if err := r.Migrate(ctx); err != nil {
+			t.Fatalf("migrate %d: %v", i, err)
+		}
+	}
+
+	u, err := r.GetByCode(ctx, "old")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if u.ClickCount != 7 || u.Disabled || u.Version != 1 || u.RedirectStatus != 0 {
+		t.Fatalf("migrated link = %+v, want 7 clicks, enabled, version 1, default redirect", u)
+	}
+
+	// url_hash дописан для старых строк
+	found, err := r.FindByURLHash(ctx, domain.URLHash("https://example.com/old"))
+	if err != nil || len(found) != 1 || found[0].Code != "old" {
+		t.Fatalf("find by hash = %+v, %v, want the legacy link", found, err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	r := openURLs(t)
+
+	if err := r.Create(ctx, "abc", "https://example.com/old", nil, 307); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	newURL := "https://example.com/new"
+	if err := r.Update(ctx, "abc", domain.LinkUpdate{OriginalURL: &newURL}, 1); err != nil {
+		t.Fatalf("update url: %v", err)
+	}
+	u, err := r.GetByCode(ctx, "abc")
+	if err != nil || u.OriginalURL != newURL || u.Disabled || u.RedirectStatus != 307 || u.Version != 2 {
+		t.Fatalf("after url update = %+v, %v, want new url at version 2, rest unchanged", u, err)
+	}
+	// хэш для дедупликации следует за адресом
+	if found, _ := r.FindByURLHash(ctx, domain.URLHash("https://example.com/old")); len(found) != 0 {
+		t.Fatalf("old url still indexed: %+v", found)
+	}
+	if found, _ := r.FindByURLHash(ctx, domain.URLHash(newURL)); len(found) != 1 {
+		t.Fatalf("new url not indexed: %+v", found)
+	}
+
+	disabled := true
+	if err := r.Update(ctx, "abc", domain.LinkUpdate{Disabled: &disabled, DisabledReason: "spam"}, 0); err != nil {
+		t.Fatalf("update without version check: %v", err)
+	}
+	u, err = r.GetByCode(ctx, "abc")
+	if err != nil || u.OriginalURL != newURL || !u.Disabled || u.DisabledReason != "spam" || u.Version != 3 {
+		t.Fatalf("after disable = %+v, %v, want disabled with reason, url kept", u, err)
+	}
+
+	if err := r.Update(ctx, "abc", domain.LinkUpdate{OriginalURL: &newURL}, 2); !errors.Is(err, domain.ErrVersionConflict) {
+		t.Fatalf("stale version: err = %v, want ErrVersionConflict", err)
+	}
+	if err := r.Update(ctx, "missing", domain.LinkUpdate{OriginalURL: &newURL}, 0); !errors.Is(err, domain.ErrURLNotFound) {
+		t.Fatalf("missing code: err = %v, want ErrURLNotFound", err)
+	}
+}
+
+func TestIncrementClicks(t *testing.T) {
+	ctx := context.Background()
+	r := openURLs(t)
+
+	for _, code := range []string{"a", "b"} {
+		if err := r.Create(ctx, code, "https://example.com/"+code, nil, 0); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	for range 2 {
+		// несуществующий код не мешает остальным
+		if err := r.IncrementClicks(ctx, map[string]int64{"a": 3, "b": 1, "gone": 5}); err != nil {
+			t.Fatalf("increment: %v", err)
+		}
+	}
+	for code, want := range map[string]int64{"a": 6, "b": 2} {
+		if u, err := r.GetByCode(ctx, code); err != nil || u.ClickCount != want {
+			t.Fatalf("%s = %+v, %v, want %d clicks", code, u, err, want)
+		}
+	}
+}
+
+func TestCreateBatch(t *testing.T) {
+	ctx := context.Background()
+	r := openURLs(t)
+
+	if err := r.Create(ctx, "taken", "https://example.com/alias", nil, 0); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	now := time.Now().UTC()
+	exp := now.Add(time.Hour)
+	skipped, err := r.CreateBatch(ctx, []domain.URL{
+		{Code: "b1", OriginalURL: "https://example.com/1", CreatedAt: now},
+		{Code: "taken", OriginalURL: "https://example.com/other", CreatedAt: now},
+		{Code: "b2", OriginalURL: "https://example.com/2", CreatedAt: now, ExpiresAt: &exp, RedirectStatus: 302},
+	})
+	if err != nil {
+		t.Fatalf("create batch: %v", err)
+	}
+	if len(skipped) != 1 || skipped[0] != "taken" {
+		t.Fatalf("skipped = %v, want [taken]", skipped)
+	}
+
+	if u, err := r.GetByCode(ctx, "taken"); err != nil || u.OriginalURL != "https://example.com/alias" {
+		t.Fatalf("existing link overwritten: %+v, %v", u, err)
+	}
+	u, err := r.GetByCode(ctx, "b2")
+	if err != nil || u.ExpiresAt == nil || u.RedirectStatus != 302 || u.Version != 1 {
+		t.Fatalf("b2 = %+v, %v, want expiry, redirect 302 and version 1", u, err)
+	}
+	if found, _ := r.FindByURLHash(ctx, domain.URLHash("https://example.com/1")); len(found) != 1 || found[0].Code != "b1" {
+		t.Fatalf("batch link not indexed by hash: %+v", found)
+	}
+}
+
+func TestFindByURLHash(t *testing.T) {
+	ctx := context.Background()
+	r := openURLs(t)
+
+	const target = "https://example.com/page"
+	past := time.Now().Add(-time.Hour)
+	for _, c := range []struct {
+		code    string
+		expires *time.Time
+	}{
+		{"old", nil},
+		{"expired", &past},
+		{"disabled", nil},
+		{"new", nil},
+	} {
+		if err := r.Create(ctx, c.code, target, c.expires, 0); err != nil {
+			t.Fatalf("create %s: %v", c.code, err)
+		}
+	}
+	if err := r.Create(ctx, "other", "https://example.com/other", nil, 0); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := r.Disable(ctx, "disabled", ""); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+
+	found, err := r.FindByURLHash(ctx, domain.URLHash(target))
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	var codes []string
+	for _, u := range found {
+		codes = append(codes, u.Code)
+	}
+	if len(codes) != 2 || codes[0] != "new" || codes[1] != "old" {
+		t.Fatalf("found = %v, want [new old]", codes)
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// growRetries — сколько коллизий за одно создание считаем признаком тесноты.
+const growRetries = 2
+
+// adaptiveLength удлиняет коды, когда пространство кодов становится тесным:
+// если одному созданию понадобилось больше growRetries повторов или повторы
+// кончились совсем. Длина только растёт; после перезапуска она начинается
+// с минимальной и при необходимости быстро набирается заново.
+type adaptiveLength struct {
+	gen      ResizableGenerator
+	min, max int
+
+	mu    sync.Mutex
+	grows atomic.Int64
+}
+
+func newAdaptiveLength(gen ResizableGenerator, min, max int) *adaptiveLength {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	gen.SetLength(min)
+	return &adaptiveLength{gen: gen, min: min, max: max}
+}
+
+// length возвращает текущую длину; 0, если подстройка выключена.
+func (a *adaptiveLength) length() int {
+	if a == nil {
+		return 0
+	}
+	return a.gen.Length()
+}
+
+// observe учитывает коллизии одного создания. used — длина, с которой оно
+// началось: если другой запрос уже удлинил коды, повторно не растём.
+// Возвращает true, если длина увеличилась.
+func (a *adaptiveLength) observe(used, collisions int, exhausted bool) bool {
+	if a == nil {
+		return false
+	}
+	if !exhausted && collisions <= growRetries {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cur := a.gen.Length()
+	if cur != used {
+		// уже выросли, пока шло это создание
+		return cur > used
+	}
+	if cur >= a.max {
+		return false
+	}
+	a.gen.SetLength(cur + 1)
+	a.grows.Add(1)
+	return true
+}
+
+func (a *adaptiveLength) stats(st *CodeStats) {
+	if a == nil {
+		return
+	}
+	st.MinLength = a.min
+	st.MaxLength = a.max
+	st.LengthGrows = a.grows.Load()
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"shortener/internal/cache"
+	"shortener/internal/domain"
+	"shortener/internal/logger"
+	"shortener/internal/repo/memory"
+)
+
+func TestAdaptiveLengthGrowsOnCollisions(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.New()
+
+	// двоичный алфавит: кодов длины 2 всего четыре, и все они уже заняты
+	binary := newAlphabet("binary", "01", nil)
+	for _, code := range []string{"00", "01", "10", "11"} {
+		if err := repo.Create(ctx, code, "https://example.com/"+code, nil, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gen := NewRandomGenerator(2, WithAlphabet(binary))
+	svc := NewURLService(repo, cache.NewURLCache(100), logger.NewNoopLogger(),
+		WithCodeGenerator(gen),
+		WithAdaptiveLength(2, 8),
+	)
+
+	// без подстройки длины первый же Shorten вернул бы ошибку
+	for i := range 40 {
+		res, err := svc.Shorten(ctx, fmt.Sprintf("https://example.com/%d", i), domain.ShortenOptions{})
+		code := res.Code
+		if err != nil {
+			t.Fatalf("shorten #%d: %v", i, err)
+		}
+		if len(code) < 3 {
+			t.Fatalf("shorten #%d: code %q still uses the exhausted length", i, code)
+		}
+	}
+
+	st := svc.(CodeStatsReporter).CodeStats()
+	if st.Length <= 2 || st.Length > 8 || st.LengthGrows == 0 {
+		t.Fatalf("stats = %+v, want length grown within [3, 8]", st)
+	}
+	if st.Collisions == 0 || st.CollisionRate <= 0 || st.Attempts != int64(40)+st.Collisions {
+		t.Fatalf("stats = %+v, want collisions counted", st)
+	}
+	if st.MinLength != 2 || st.MaxLength != 8 {
+		t.Fatalf("stats = %+v, want min=2 max=8", st)
+	}
+}
+
+func TestAdaptiveLengthStopsAtMax(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.New()
+	binary := newAlphabet("binary", "01", nil)
+	for _, code := range []string{"00", "01", "10", "11"} {
+		if err := repo.Create(ctx, code, "https://example.com/"+code, nil, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	svc := NewURLService(repo, cache.NewURLCache(100), logger.NewNoopLogger(),
+		WithCodeGenerator(NewRandomGenerator(2, WithAlphabet(binary))),
+		WithAdaptiveLength(2, 2),
+	)
+	if _, err := svc.Shorten(ctx, "https://example.com/x", domain.ShortenOptions{}); err == nil {
+		t.Fatal("expected error when keyspace is exhausted at max length")
+	}
+}
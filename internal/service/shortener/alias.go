@@ -0,0 +1,52 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"shortener/internal/domain"
+)
+
+const (
+	minAliasLen = 3
+	maxAliasLen = 32
+)
+
+// reservedAliases — пути, которые заняты сервисом или могут понадобиться в будущем.
+var reservedAliases = map[string]struct{}{
+	"api":     {},
+	"admin":   {},
+	"health":  {},
+	"healthz": {},
+	"metrics": {},
+	"debug":   {},
+	"static":  {},
+	"login":   {},
+	"logout":  {},
+}
+
+// validateAlias проверяет пользовательский код и возвращает его канонический
+// вид в формате f: именно так код ищет резолвер. Длина и символы проверяются
+// после нормализации по алфавиту генератора, поэтому в base32 Крокфорда
+// "spring-sale" сохраняется как "SPR1NGSA1E" и открывается в обоих написаниях.
+func validateAlias(alias string, f CodeFormat) (string, error) {
+	a := f.Alphabet
+	if a == nil {
+		a = Base64URL
+	}
+	code := f.Normalize(alias)
+	if n := len(code); n < minAliasLen || n > maxAliasLen {
+		return "", fmt.Errorf("%w: length must be between %d and %d", domain.ErrInvalidAlias, minAliasLen, maxAliasLen)
+	}
+	for i := 0; i < len(code); i++ {
+		if a.index[code[i]] < 0 {
+			return "", fmt.Errorf("%w: character %q is not allowed in %s codes", domain.ErrInvalidAlias, code[i], a.Name())
+		}
+	}
+	for _, s := range []string{alias, code} {
+		if _, ok := reservedAliases[strings.ToLower(s)]; ok {
+			return "", fmt.Errorf("%w: %q is reserved", domain.ErrInvalidAlias, alias)
+		}
+	}
+	return code, nil
+}
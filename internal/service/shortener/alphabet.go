@@ -0,0 +1,206 @@
+package service
+
+import (
+	"math/bits"
+	"strings"
+)
+
+// Alphabet — набор символов для генерируемых кодов.
+type Alphabet struct {
+	name    string
+	symbols string
+	index   [256]int8 // значение символа, -1 — не из алфавита
+	bits    int       // бит на символ
+
+	// fold приводит ввод к каноническому виду (регистр, похожие символы).
+	fold func(code string) string
+}
+
+func newAlphabet(name, symbols string, fold func(string) string) *Alphabet {
+	a := &Alphabet{name: name, symbols: symbols, fold: fold, bits: bits.Len(uint(len(symbols) - 1))}
+	for i := range a.index {
+		a.index[i] = -1
+	}
+	for i := 0; i < len(symbols); i++ {
+		a.index[symbols[i]] = int8(i)
+	}
+	return a
+}
+
+var (
+	// Base64URL — исходный алфавит: 64 символа, различает регистр.
+	Base64URL = newAlphabet("base64url", alphabet, nil)
+
+	// Crockford32 — base32 Крокфорда: без I, L, O, U, регистр не важен,
+	// O читается как 0, I и L — как 1, дефисы для удобства чтения игнорируются.
+	Crockford32 = newAlphabet("crockford", "0123456789ABCDEFGHJKMNPQRSTVWXYZ", foldCrockford)
+)
+
+func (a *Alphabet) Name() string { return a.name }
+func (a *Alphabet) Size() int    { return len(a.symbols) }
+
+// Normalize приводит введённый код к каноническому виду алфавита.
+func (a *Alphabet) Normalize(code string) string {
+	if a.fold == nil {
+		return code
+	}
+	return a.fold(code)
+}
+
+// crockfordReplacer — опечатки, которые base32 Крокфорда трактует однозначно.
+var crockfordReplacer = strings.NewReplacer("-", "", "O", "0", "I", "1", "L", "1")
+
+func foldCrockford(code string) string {
+	return crockfordReplacer.Replace(strings.ToUpper(code))
+}
+
+// checkSymbols — символы контрольной суммы по модулю 37 (по Крокфорду).
+const checkSymbols = "0123456789ABCDEFGHJKMNPQRSTVWXYZ*~$=U"
+
+// SupportsCheckChar сообщает, применим ли к алфавиту контрольный символ:
+// по модулю 37 гарантированно ловится любая одиночная замена, только если
+// в алфавите меньше 37 символов.
+func (a *Alphabet) SupportsCheckChar() bool {
+	return a.Size() < len(checkSymbols)
+}
+
+func (a *Alphabet) checksum(data string) (int, bool) {
+	sum := 0
+	for i := 0; i < len(data); i++ {
+		v := a.index[data[i]]
+		if v < 0 {
+			return 0, false
+		}
+		sum = (sum*a.Size() + int(v)) % len(checkSymbols)
+	}
+	return sum, true
+}
+
+// CodeFormat описывает вид генерируемых кодов: алфавит и необязательный
+// контрольный символ в конце, который отличает опечатку от неизвестного кода.
+type CodeFormat struct {
+	Alphabet  *Alphabet
+	CheckChar bool
+}
+
+// GenOption настраивает формат кодов генератора.
+type GenOption func(*CodeFormat)
+
+// WithAlphabet задаёт алфавит кодов. По умолчанию — Base64URL.
+func WithAlphabet(a *Alphabet) GenOption {
+	return func(f *CodeFormat) {
+		f.Alphabet = a
+	}
+}
+
+// WithCheckChar добавляет к коду контрольный символ. Имеет смысл только для
+// алфавитов с SupportsCheckChar, например Crockford32.
+func WithCheckChar() GenOption {
+	return func(f *CodeFormat) {
+		f.CheckChar = true
+	}
+}
+
+func newCodeFormat(opts []GenOption) CodeFormat {
+	f := CodeFormat{Alphabet: Base64URL}
+	for _, opt := range opts {
+		opt(&f)
+	}
+	return f
+}
+
+// Normalize приводит введённый пользователем код к каноническому виду.
+func (f CodeFormat) Normalize(code string) string {
+	if f.Alphabet == nil {
+		return code
+	}
+	return f.Alphabet.Normalize(code)
+}
+
+// finish дописывает контрольный символ, если он включён.
+func (f CodeFormat) finish(code string) string {
+	if !f.CheckChar {
+		return code
+	}
+	sum, _ := f.Alphabet.checksum(code)
+	return code + string(checkSymbols[sum])
+}
+
+// Valid проверяет контрольный символ. Без контрольного символа любой код валиден.
+func (f CodeFormat) Valid(code string) bool {
+	if !f.CheckChar {
+		return true
+	}
+	if len(code) < 2 {
+		return false
+	}
+	sum, ok := f.Alphabet.checksum(code[:len(code)-1])
+	return ok && checkSymbols[sum] == code[len(code)-1]
+}
+
+// Corrections возвращает коды с верным контрольным символом, которые
+// отличаются от code одной заменой символа или перестановкой соседних.
+func (f CodeFormat) Corrections(code string) []string {
+	if !f.CheckChar || len(code) < 2 {
+		return nil
+	}
+
+	seen := make(map[string]struct{})
+	var out []string
+	try := func(b []byte) {
+		c := string(b)
+		if _, ok := seen[c]; ok || c == code || !f.Valid(c) {
+			return
+		}
+		seen[c] = struct{}{}
+		out = append(out, c)
+	}
+
+	buf := []byte(code)
+	last := len(buf) - 1
+	for i := range buf {
+		symbols := f.Alphabet.symbols
+		if i == last {
+			symbols = checkSymbols
+		}
+		orig := buf[i]
+		for j := 0; j < len(symbols); j++ {
+			buf[i] = symbols[j]
+			try(buf)
+		}
+		buf[i] = orig
+	}
+	for i := 0; i < last; i++ {
+		buf[i], buf[i+1] = buf[i+1], buf[i]
+		try(buf)
+		buf[i], buf[i+1] = buf[i+1], buf[i]
+	}
+	return out
+}
+
+// encodeFixed записывает число ровно n символами алфавита (старшие разряды отбрасываются).
+func (a *Alphabet) encodeFixed(v uint64, n int) string {
+	out := make([]byte, n)
+	size := uint64(a.Size())
+	for i := n - 1; i >= 0; i-- {
+		out[i] = a.symbols[v%size]
+		v /= size
+	}
+	return string(out)
+}
+
+// encode записывает число в алфавите без ведущих нулей.
+func (a *Alphabet) encode(v uint64) string {
+	var buf [64]byte
+	size := uint64(a.Size())
+	i := len(buf)
+	for {
+		i--
+		buf[i] = a.symbols[v%size]
+		v /= size
+		if v == 0 {
+			break
+		}
+	}
+	return string(buf[i:])
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CodeFilter решает, можно ли выдать сгенерированный код. Отвергнутый код
+// генерируется заново.
+type CodeFilter interface {
+	Allowed(code string) bool
+}
+
+// Blocklist отвергает коды, в которых подстрокой встречается слово из
+// списка. Сравнение идёт после нормализации: регистр, разделители и
+// leetspeak (0→o, 1→i, 3→e, 4→a, 5→s, 7→t, ...) не помогают обойти список.
+type Blocklist struct {
+	words []string
+}
+
+func NewBlocklist(words []string) *Blocklist {
+	b := &Blocklist{}
+	for _, w := range words {
+		if w = leetNormalize(strings.TrimSpace(w)); w != "" {
+			b.words = append(b.words, w)
+		}
+	}
+	return b
+}
+
+// LoadBlocklist читает список слов из файла: по слову в строке, пустые
+// строки и строки, начинающиеся с #, пропускаются.
+func LoadBlocklist(path string) (*Blocklist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open blocklist: %w", err)
+	}
+	defer f.Close()
+
+	var words []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read blocklist: %w", err)
+	}
+	return NewBlocklist(words), nil
+}
+
+func (b *Blocklist) Len() int { return len(b.words) }
+
+func (b *Blocklist) Allowed(code string) bool {
+	norm := leetNormalize(code)
+	for _, w := range b.words {
+		if strings.Contains(norm, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// leetTable сводит похожие на буквы цифры и символы к одной букве. 1 и l
+// считаются за i, чтобы «1» совпадала с обоими вариантами написания.
+var leetTable = func() [256]byte {
+	var t [256]byte
+	for c := 'a'; c <= 'z'; c++ {
+		t[c] = byte(c)
+		t[c-'a'+'A'] = byte(c)
+	}
+	for from, to := range map[byte]byte{
+		'0': 'o', '1': 'i', 'l': 'i', '!': 'i', '|': 'i',
+		'2': 'z', '3': 'e', '4': 'a', '@': 'a', '5': 's', '$': 's',
+		'6': 'g', '9': 'g', '7': 't', '8': 'b',
+		'L': 'i',
+	} {
+		t[from] = to
+	}
+	return t
+}()
+
+// leetNormalize приводит строку к виду для сравнения; символы вне таблицы
+// (разделители - и _, контрольные символы кода) отбрасываются.
+func leetNormalize(s string) string {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if c := leetTable[s[i]]; c != 0 {
+			out = append(out, c)
+		}
+	}
+	return string(out)
+}
+
+// acceptableCode проверяет сгенерированный код: он не должен совпадать с
+// зарезервированным путём и должен пройти фильтр (если задан).
+func acceptableCode(f CodeFilter, code string) bool {
+	if _, ok := reservedAliases[strings.ToLower(code)]; ok {
+		return false
+	}
+	return f == nil || f.Allowed(code)
+}
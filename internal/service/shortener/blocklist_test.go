@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"shortener/internal/cache"
+	"shortener/internal/domain"
+	"shortener/internal/logger"
+	"shortener/internal/repo/memory"
+)
+
+func TestBlocklistLeetAndSubstring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("# test list\nbad\n\n  fool \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bl, err := LoadBlocklist(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if bl.Len() != 2 {
+		t.Fatalf("len = %d, want 2", bl.Len())
+	}
+
+	for code, allowed := range map[string]bool{
+		"xyBADxyz": false,
+		"q8AD1234": false, // 8 → b
+		"zzF00Lzz": false, // 0 → o
+		"F0-0_1xx": false, // разделители игнорируются, 1 и l → i
+		"goodcode": true,
+		"Xb4Y2dzz": true,
+	} {
+		if got := bl.Allowed(code); got != allowed {
+			t.Errorf("Allowed(%q) = %t, want %t", code, got, allowed)
+		}
+	}
+}
+
+// seqGenerator выдаёт заранее заданные коды по очереди.
+type seqGenerator struct {
+	codes []string
+	i     int
+}
+
+func (g *seqGenerator) Generate(string, int) string {
+	code := g.codes[g.i%len(g.codes)]
+	g.i++
+	return code
+}
+func (g *seqGenerator) Unique() bool       { return false }
+func (g *seqGenerator) Format() CodeFormat { return newCodeFormat(nil) }
+
+func TestShortenRegeneratesBlockedCodes(t *testing.T) {
+	svc := NewURLService(memory.New(), cache.NewURLCache(10), logger.NewNoopLogger(),
+		WithCodeGenerator(&seqGenerator{codes: []string{"xxBADxxx", "admin", "okcode01"}}),
+		WithCodeFilter(NewBlocklist([]string{"bad"})),
+	)
+
+	res, err := svc.Shorten(context.Background(), "https://example.com", domain.ShortenOptions{})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if code := res.Code; code != "okcode01" {
+		t.Fatalf("code = %q, want okcode01", code)
+	}
+	// отвергнуты и слово из списка, и зарезервированный путь
+	if got := svc.(CodeStatsReporter).CodeStats().Rejected; got != 2 {
+		t.Fatalf("rejected = %d, want 2", got)
+	}
+}
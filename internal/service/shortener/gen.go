@@ -2,13 +2,36 @@ package service
 
 import (
 	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
 	mrand "math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-_"
 const alphabetSize = byte(len(alphabet))
 
+// CodeGenerator выдаёт кандидатов в короткие коды.
+type CodeGenerator interface {
+	// Generate возвращает код для originalURL; attempt > 0 — повтор после коллизии.
+	Generate(originalURL string, attempt int) string
+	// Unique сообщает, что коды не повторяются и проверять занятость заранее не нужно.
+	Unique() bool
+	// Format описывает вид кодов: по нему резолвер нормализует ввод и ловит опечатки.
+	Format() CodeFormat
+}
+
+// ResizableGenerator — генератор, длину кодов которого можно менять на лету.
+// Её увеличивает сервис, когда пространство кодов становится тесным.
+type ResizableGenerator interface {
+	CodeGenerator
+	Length() int
+	SetLength(n int)
+}
+
 func generateCode(n int) string {
 	if n <= 0 {
 		return ""
@@ -29,3 +52,159 @@ func generateCode(n int) string {
 	}
 	return string(buf)
 }
+
+// RandomGenerator — случайные коды фиксированной длины. Коллизии возможны,
+// их разрешает цикл повторов в Shorten.
+type RandomGenerator struct {
+	length atomic.Int64
+	format CodeFormat
+}
+
+func NewRandomGenerator(length int, opts ...GenOption) *RandomGenerator {
+	g := &RandomGenerator{format: newCodeFormat(opts)}
+	g.length.Store(int64(length))
+	return g
+}
+
+func (g *RandomGenerator) Generate(string, int) string {
+	n := g.Length()
+	a := g.format.Alphabet
+	if a == Base64URL {
+		return g.format.finish(generateCode(n))
+	}
+
+	// размер алфавита — степень двойки, так что остаток от деления не смещает распределение
+	buf := make([]byte, n)
+	if _, err := crand.Read(buf); err != nil {
+		src := mrand.New(mrand.NewSource(time.Now().UnixNano()))
+		src.Read(buf)
+	}
+	for i, b := range buf {
+		buf[i] = a.symbols[int(b)%a.Size()]
+	}
+	return g.format.finish(string(buf))
+}
+
+func (g *RandomGenerator) Unique() bool       { return false }
+func (g *RandomGenerator) Format() CodeFormat { return g.format }
+func (g *RandomGenerator) Length() int        { return int(g.length.Load()) }
+func (g *RandomGenerator) SetLength(n int)    { g.length.Store(int64(n)) }
+
+// HashGenerator — детерминированный код из SHA-256 адреса: один и тот же URL
+// даёт один и тот же код, при коллизии к адресу подмешивается номер попытки.
+type HashGenerator struct {
+	length atomic.Int64
+	format CodeFormat
+}
+
+func NewHashGenerator(length int, opts ...GenOption) *HashGenerator {
+	g := &HashGenerator{format: newCodeFormat(opts)}
+	g.length.Store(int64(length))
+	return g
+}
+
+func (g *HashGenerator) Generate(originalURL string, attempt int) string {
+	h := sha256.New()
+	h.Write([]byte(originalURL))
+	if attempt > 0 {
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], uint64(attempt))
+		h.Write(buf[:])
+	}
+	sum := h.Sum(nil)
+
+	// символ на байт хэша: длина ограничена его размером
+	a := g.format.Alphabet
+	n := min(g.Length(), len(sum))
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = a.symbols[int(sum[i])%a.Size()]
+	}
+	return g.format.finish(string(out))
+}
+
+func (g *HashGenerator) Unique() bool       { return false }
+func (g *HashGenerator) Format() CodeFormat { return g.format }
+func (g *HashGenerator) Length() int        { return int(g.length.Load()) }
+func (g *HashGenerator) SetLength(n int)    { g.length.Store(int64(n)) }
+
+// Параметры FeistelGenerator: 48-битный блок (8 символов base64url или 10
+// base32), из них 30 бит — секунды от snowflakeEpoch, 18 бит — счётчик
+// внутри секунды.
+const (
+	feistelBlockBits = 48
+	feistelHalfBits  = feistelBlockBits / 2
+	feistelHalfMask  = 1<<feistelHalfBits - 1
+	feistelRounds    = 4
+	feistelSeqBits   = 18
+	feistelMaxSeq    = 1<<feistelSeqBits - 1
+)
+
+// FeistelGenerator нумерует коды монотонным счётчиком и переставляет номер
+// ключевой сетью Фейстеля. Перестановка обратима, поэтому разные номера дают
+// разные коды, а без ключа соседние коды не угадать. Счётчик растёт вместе со
+// временем, так что после перезапуска номера не повторяются; ключ должен
+// быть постоянным.
+type FeistelGenerator struct {
+	keys   [feistelRounds]uint32
+	format CodeFormat
+	length int
+
+	mu   sync.Mutex
+	last uint64
+	now  func() time.Time
+}
+
+func NewFeistelGenerator(key []byte, opts ...GenOption) (*FeistelGenerator, error) {
+	if len(key) == 0 {
+		return nil, errors.New("feistel generator requires a non-empty key")
+	}
+	f := newCodeFormat(opts)
+	g := &FeistelGenerator{
+		format: f,
+		length: (feistelBlockBits + f.Alphabet.bits - 1) / f.Alphabet.bits,
+		now:    time.Now,
+	}
+	sum := sha256.Sum256(key)
+	for i := range g.keys {
+		g.keys[i] = binary.BigEndian.Uint32(sum[i*4:])
+	}
+	return g, nil
+}
+
+func (g *FeistelGenerator) Generate(string, int) string {
+	g.mu.Lock()
+	n := uint64(g.now().Sub(snowflakeEpoch)/time.Second) << feistelSeqBits
+	if n <= g.last {
+		// та же секунда (или часы отстали) — следующий номер; при переполнении
+		// счётчика он сам перетекает в следующую секунду
+		n = g.last + 1
+	}
+	g.last = n
+	g.mu.Unlock()
+
+	return g.format.finish(g.format.Alphabet.encodeFixed(g.permute(n), g.length))
+}
+
+func (g *FeistelGenerator) Unique() bool       { return true }
+func (g *FeistelGenerator) Format() CodeFormat { return g.format }
+
+func (g *FeistelGenerator) permute(n uint64) uint64 {
+	l := uint32(n>>feistelHalfBits) & feistelHalfMask
+	r := uint32(n) & feistelHalfMask
+	for _, k := range g.keys {
+		l, r = r, l^(feistelRound(r, k)&feistelHalfMask)
+	}
+	return uint64(l)<<feistelHalfBits | uint64(r)
+}
+
+// feistelRound — раундовая функция: перемешивание в духе финализатора murmur3.
+func feistelRound(x, k uint32) uint32 {
+	x ^= k
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"strconv"
 	"testing"
 	"time"
 )
@@ -18,3 +19,43 @@ func BenchmarkGenerateCodeThroughput(b *testing.B) {
 	codesPerSec := float64(b.N) / elapsed.Seconds()
 	b.ReportMetric(codesPerSec, "id/s")
 }
+
+func BenchmarkCodeGenerators(b *testing.B) {
+	feistel, err := NewFeistelGenerator([]byte("bench"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	snowflake, err := NewSnowflake(1)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	gens := []struct {
+		name string
+		gen  CodeGenerator
+	}{
+		{"random", NewRandomGenerator(8)},
+		{"feistel", feistel},
+		{"snowflake", snowflake},
+		{"hash", NewHashGenerator(8)},
+	}
+
+	urls := make([]string, 1024)
+	for i := range urls {
+		urls[i] = "https://example.com/page/" + strconv.Itoa(i)
+	}
+
+	for _, g := range gens {
+		b.Run(g.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				_ = g.gen.Generate(urls[i%len(urls)], 0)
+			}
+			elapsed := time.Since(start)
+
+			b.ReportMetric(float64(b.N)/elapsed.Seconds(), "id/s")
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnowflakeUniqueAcrossNodes(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now } // часы стоят: проверяем и переполнение счётчика
+
+	seen := make(map[string]int64)
+	for node := int64(0); node < 3; node++ {
+		sf, err := NewSnowflake(node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sf.now = clock
+		for range 3 * (maxSeq + 1) {
+			code := sf.Generate("", 0)
+			if prev, ok := seen[code]; ok {
+				t.Fatalf("code %q from node %d already issued by node %d", code, node, prev)
+			}
+			seen[code] = node
+		}
+	}
+}
+
+func TestSnowflakeNodeRange(t *testing.T) {
+	if _, err := NewSnowflake(MaxNodeID + 1); err == nil {
+		t.Fatal("expected error for node id out of range")
+	}
+	if _, err := NewSnowflake(-1); err == nil {
+		t.Fatal("expected error for negative node id")
+	}
+}
+
+func TestFeistelUniqueAndFixedLength(t *testing.T) {
+	g, err := NewFeistelGenerator([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	g.now = func() time.Time { return now }
+
+	seen := make(map[string]bool)
+	prev := ""
+	for range 2 * (feistelMaxSeq + 1) {
+		code := g.Generate("", 0)
+		if len(code) != g.length {
+			t.Fatalf("code %q: len = %d, want %d", code, len(code), g.length)
+		}
+		if seen[code] {
+			t.Fatalf("duplicate code %q", code)
+		}
+		seen[code] = true
+		prev = code
+	}
+
+	// тот же ключ — та же перестановка, другой ключ — другая
+	other, _ := NewFeistelGenerator([]byte("other"))
+	other.now, other.last = g.now, g.last-1
+	same, _ := NewFeistelGenerator([]byte("secret"))
+	same.now, same.last = g.now, g.last-1
+	if got := same.Generate("", 0); got != prev {
+		t.Fatalf("same key: %q, want %q", got, prev)
+	}
+	if got := other.Generate("", 0); got == prev {
+		t.Fatalf("different key produced the same code %q", got)
+	}
+}
+
+func TestHashDeterministic(t *testing.T) {
+	g := NewHashGenerator(8)
+	a := g.Generate("https://example.com/a", 0)
+	if len(a) != 8 {
+		t.Fatalf("len = %d, want 8", len(a))
+	}
+	if b := g.Generate("https://example.com/a", 0); a != b {
+		t.Fatalf("same url: %q != %q", a, b)
+	}
+	if b := g.Generate("https://example.com/a", 1); a == b {
+		t.Fatal("retry attempt must change the code")
+	}
+	if b := g.Generate("https://example.com/b", 0); a == b {
+		t.Fatal("different urls produced the same code")
+	}
+}
+
+func TestCrockfordCheckChar(t *testing.T) {
+	f := newCodeFormat([]GenOption{WithAlphabet(Crockford32), WithCheckChar()})
+
+	code := f.finish("0A1B2C3D")
+	if !f.Valid(code) {
+		t.Fatalf("%q: check character rejected", code)
+	}
+	if got := f.Normalize("oa1b-2c3d" + code[len(code)-1:]); got != code {
+		t.Fatalf("normalize = %q, want %q", got, code)
+	}
+
+	// любая одиночная замена и перестановка соседних символов ловится
+	for _, bad := range []string{"0A1B2C3E" + code[8:], "A01B2C3D" + code[8:]} {
+		if f.Valid(bad) {
+			t.Fatalf("%q: typo not detected", bad)
+		}
+		found := false
+		for _, c := range f.Corrections(bad) {
+			found = found || c == code
+		}
+		if !found {
+			t.Fatalf("corrections for %q do not include %q", bad, code)
+		}
+	}
+}
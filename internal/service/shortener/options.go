@@ -0,0 +1,119 @@
+package service
+
+import (
+	"net/url"
+	"time"
+
+	"shortener/internal/domain"
+	"shortener/internal/trending"
+)
+
+type Option func(*urlService)
+
+// WithMaxTTL ограничивает срок жизни создаваемых ссылок. 0 — без ограничений.
+func WithMaxTTL(d time.Duration) Option {
+	return func(s *urlService) {
+		s.maxTTL = d
+	}
+}
+
+// WithClickRecorder включает учёт переходов: каждый успешный Resolve передаётся в r.
+func WithClickRecorder(r ClickRecorder) Option {
+	return func(s *urlService) {
+		s.clicks = r
+	}
+}
+
+// WithAnalytics включает выдачу статистики переходов из repo.
+func WithAnalytics(repo domain.AnalyticsRepository) Option {
+	return func(s *urlService) {
+		s.analytics = repo
+	}
+}
+
+// WithTrending включает выдачу популярных ссылок из tr.
+func WithTrending(tr *trending.Tracker) Option {
+	return func(s *urlService) {
+		s.trending = tr
+	}
+}
+
+// WithWriteBehind включает асинхронное создание ссылок со случайным кодом.
+// Пользовательские алиасы по-прежнему создаются синхронно, чтобы вернуть 409,
+// в том числе при совпадении с ещё не записанным сгенерированным кодом.
+func WithWriteBehind(w *WriteBehind) Option {
+	return func(s *urlService) {
+		s.writeBehind = w
+	}
+}
+
+// WithCodeGenerator задаёт способ генерации кодов. По умолчанию — 8 случайных символов.
+func WithCodeGenerator(g CodeGenerator) Option {
+	return func(s *urlService) {
+		s.gen = g
+	}
+}
+
+// WithCodeFilter отбраковывает сгенерированные коды, не прошедшие f, например
+// по списку нежелательных слов. Пользовательские алиасы не фильтруются.
+func WithCodeFilter(f CodeFilter) Option {
+	return func(s *urlService) {
+		s.filter = f
+	}
+}
+
+// WithAdaptiveLength включает рост длины кодов от min до max, когда коллизий
+// становится много. Действует для генераторов с настраиваемой длиной
+// (ResizableGenerator), независимо от порядка опций.
+func WithAdaptiveLength(min, max int) Option {
+	return func(s *urlService) {
+		s.minCodeLen, s.maxCodeLen = min, max
+	}
+}
+
+// WithDedup включает дедупликацию: для адреса, на который уже есть действующая
+// ссылка, Shorten возвращает её код вместо новой. Не действует для алиасов и
+// ссылок с заданным сроком жизни.
+func WithDedup() Option {
+	return func(s *urlService) {
+		s.dedup = true
+	}
+}
+
+// WithURLRules задаёт допустимые схемы адресов назначения и их максимальную
+// длину. Пустой список — http и https, maxLength <= 0 — DefaultMaxURLLength.
+func WithURLRules(schemes []string, maxLength int) Option {
+	return func(s *urlService) {
+		s.urls = newURLRules(schemes, maxLength)
+	}
+}
+
+// WithPolicy включает проверку адресов назначения по p при создании и
+// изменении ссылок (ошибка с правилом RulePolicy) и при переходе
+// (domain.ErrURLBlocked).
+func WithPolicy(p DestinationPolicy) Option {
+	return func(s *urlService) {
+		s.policy = p
+	}
+}
+
+// WithSelfLinkGuard запрещает ссылки на сам сокращатель: на хост base и
+// дополнительные домены aliasDomains. При maxDepth > 0 такие ссылки
+// разрешены, если цепочка коротких ссылок заканчивается внешним адресом не
+// более чем через maxDepth переходов и не образует цикла.
+func WithSelfLinkGuard(base *url.URL, aliasDomains []string, maxDepth int) Option {
+	return func(s *urlService) {
+		s.selfLinks = newSelfLinks(base, aliasDomains, maxDepth)
+	}
+}
+
+// WithDefaultRedirect задаёт статус редиректа для ссылок, создаваемых без
+// явного статуса (по умолчанию 301). Для ссылок со сроком жизни постоянный
+// редирект заменяется на 302. Недопустимый статус игнорируется.
+func WithDefaultRedirect(status int) Option {
+	return func(s *urlService) {
+		if domain.ValidRedirectStatus(status) {
+			s.defaultRedirect = status
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+
+	"shortener/internal/domain"
+)
+
+// RuleLoop — адрес ведёт на сам сокращатель и образует цикл (или переходы
+// по цепочке не разрешены).
+const RuleLoop = "loop"
+
+// selfLinks распознаёт адреса, ведущие на сам сокращатель: по хосту базового
+// URL, дополнительным доменам и хосту, на который пришёл запрос (без
+// базового URL другого способа узнать свой адрес нет). Порт и схема не
+// учитываются — на том же хосте по http и https отвечает один и тот же сервис.
+type selfLinks struct {
+	hosts    map[string]struct{}
+	basePath string // со слэшем на конце
+	maxDepth int
+}
+
+func newSelfLinks(base *url.URL, aliasDomains []string, maxDepth int) *selfLinks {
+	sl := &selfLinks{hosts: make(map[string]struct{}), basePath: "/", maxDepth: maxDepth}
+	if base != nil && base.Host != "" {
+		if h, err := normalizeHost(base.Hostname()); err == nil {
+			sl.hosts[h] = struct{}{}
+		}
+		if p := strings.Trim(base.Path, "/"); p != "" {
+			sl.basePath = "/" + p + "/"
+		}
+	}
+	for _, d := range aliasDomains {
+		if h, ok := hostOnly(d); ok {
+			sl.hosts[h] = struct{}{}
+		}
+	}
+	return sl
+}
+
+// hostOnly приводит хост (возможно, с портом) к виду, в котором он хранится в hosts.
+func hostOnly(hostport string) (string, bool) {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		hostport = host
+	}
+	h, err := normalizeHost(hostport)
+	return h, err == nil
+}
+
+// code возвращает короткий код, если адрес ведёт на сокращатель. reqHost —
+// нормализованный хост запроса или пусто. ok == true и пустой код — адрес
+// наш, но не похож на короткую ссылку (например, API).
+func (sl *selfLinks) code(rawURL, reqHost string) (code string, ok bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	host := strings.ToLower(u.Hostname())
+	if _, ok := sl.hosts[host]; !ok && (reqHost == "" || host != reqHost) {
+		return "", false
+	}
+	// так же, как обработчик редиректа: с префиксом базового пути или без
+	code = strings.TrimPrefix(u.Path, "/")
+	if sl.basePath != "/" && strings.HasPrefix(u.Path, sl.basePath) {
+		code = strings.TrimPrefix(u.Path, sl.basePath)
+	}
+	if strings.Contains(code, "/") {
+		return "", true
+	}
+	return code, true
+}
+
+// checkSelfLink не даёт сделать ссылку на сам сокращатель, если это образует
+// цикл. Если переходы по цепочке разрешены (maxDepth > 0), цепочка проходится
+// внутри сервиса: она должна закончиться внешним адресом не более чем через
+// maxDepth ссылок и не проходить через own (код, который создаётся или
+// меняется). Без этого любая ссылка на свой домен отвергается. host — хост,
+// на который пришёл запрос.
+func (s *urlService) checkSelfLink(ctx context.Context, own, host, originalURL string) error {
+	sl := s.selfLinks
+	if sl == nil {
+		return nil
+	}
+	reqHost, _ := hostOnly(host)
+	code, ok := sl.code(originalURL, reqHost)
+	if !ok {
+		return nil
+	}
+	if sl.maxDepth <= 0 {
+		return invalidURL(RuleLoop, "destination points to this url shortener")
+	}
+
+	seen := map[string]struct{}{}
+	if own != "" {
+		seen[own] = struct{}{}
+	}
+	for depth := 1; ok; depth++ {
+		if code == "" {
+			return invalidURL(RuleLoop, "destination points to this url shortener but is not a short link")
+		}
+		if _, dup := seen[code]; dup {
+			return invalidURL(RuleLoop, "redirect chain loops back to %q", code)
+		}
+		if depth > sl.maxDepth {
+			return invalidURL(RuleLoop, "redirect chain is longer than %d links", sl.maxDepth)
+		}
+		u, err := s.lookupSelf(ctx, code)
+		if err != nil {
+			if errors.Is(err, domain.ErrURLNotFound) || errors.Is(err, domain.ErrURLExpired) {
+				return invalidURL(RuleLoop, "destination short link %q does not exist", code)
+			}
+			return err
+		}
+		if _, dup := seen[u.Code]; dup {
+			return invalidURL(RuleLoop, "redirect chain loops back to %q", u.Code)
+		}
+		seen[u.Code] = struct{}{}
+		code, ok = sl.code(u.OriginalURL, reqHost)
+	}
+	return nil
+}
+
+// lookupSelf ищет код из адреса так же, как обработчик редиректа — в
+// каноническом виде алфавита.
+func (s *urlService) lookupSelf(ctx context.Context, code string) (*domain.URL, error) {
+	return s.getByCode(ctx, s.gen.Format().Normalize(code))
+}
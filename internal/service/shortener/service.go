@@ -5,79 +5,512 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"sync/atomic"
 	"time"
 
 	"shortener/internal/cache"
 	"shortener/internal/domain"
+	"shortener/internal/policy"
+	"shortener/internal/trending"
 )
 
+// ClickRecorder принимает факт перехода по ссылке. Вызывается на пути редиректа,
+// поэтому реализация не должна блокироваться.
+type ClickRecorder interface {
+	Record(ev domain.ClickEvent)
+}
+
+// DestinationPolicy решает, можно ли вести короткую ссылку на адрес.
+// Проверяется и при создании, и при каждом переходе, поэтому смена правил
+// действует и на уже созданные ссылки.
+type DestinationPolicy interface {
+	CheckURL(rawURL string) policy.Decision
+}
+
 type urlService struct {
 	repo   domain.URLRepository
 	cache  *cache.URLCache
 	logger *slog.Logger
+
+	maxTTL    time.Duration
+	clicks    ClickRecorder
+	analytics domain.AnalyticsRepository
+	trending  *trending.Tracker
+
+	writeBehind *WriteBehind
+	gen         CodeGenerator
+	filter      CodeFilter
+	adaptive    *adaptiveLength
+	dedup       bool
+	urls        urlRules
+	policy      DestinationPolicy
+	selfLinks   *selfLinks
+
+	// defaultRedirect — статус редиректа для ссылок, где он не указан
+	defaultRedirect int
+
+	// параметры WithAdaptiveLength; применяются после всех опций
+	minCodeLen, maxCodeLen int
+
+	attempts   atomic.Int64
+	collisions atomic.Int64
+	rejected   atomic.Int64
+}
+
+// CodeStats — статистика генерации кодов.
+type CodeStats struct {
+	// Length — текущая длина кодов (0, если генератор её не задаёт).
+	Length      int   `json:"length"`
+	MinLength   int   `json:"min_length,omitempty"`
+	MaxLength   int   `json:"max_length,omitempty"`
+	LengthGrows int64 `json:"length_grows"`
+
+	// Attempts — попытки записи сгенерированного кода, Collisions — из них
+	// неудачные из-за занятого кода.
+	Attempts      int64   `json:"attempts"`
+	Collisions    int64   `json:"collisions"`
+	CollisionRate float64 `json:"collision_rate"`
+
+	// Rejected — сколько сгенерированных кодов отвергнуто фильтром и сгенерировано заново.
+	Rejected int64 `json:"rejected"`
+}
+
+// CodeStatsReporter реализует сервис, созданный NewURLService.
+type CodeStatsReporter interface {
+	CodeStats() CodeStats
+}
+
+func NewURLService(repo domain.URLRepository, cache *cache.URLCache, logger *slog.Logger, opts ...Option) domain.URLService {
+	s := &urlService{
+		repo:   repo,
+		cache:  cache,
+		logger: logger,
+
+		gen:             NewRandomGenerator(8),
+		urls:            newURLRules(nil, 0),
+		defaultRedirect: http.StatusMovedPermanently,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if rg, ok := s.gen.(ResizableGenerator); ok && s.maxCodeLen > 0 {
+		s.adaptive = newAdaptiveLength(rg, s.minCodeLen, s.maxCodeLen)
+	}
+	return s
+}
+
+func (s *urlService) CodeStats() CodeStats {
+	st := CodeStats{
+		Attempts:   s.attempts.Load(),
+		Collisions: s.collisions.Load(),
+		Rejected:   s.rejected.Load(),
+	}
+	if st.Attempts > 0 {
+		st.CollisionRate = float64(st.Collisions) / float64(st.Attempts)
+	}
+	if rg, ok := s.gen.(ResizableGenerator); ok {
+		st.Length = rg.Length()
+	}
+	s.adaptive.stats(&st)
+	return st
+}
+
+func (s *urlService) Shorten(ctx context.Context, originalURL string, opts domain.ShortenOptions) (domain.ShortenResult, error) {
+	alias := opts.Alias
+	if alias != "" {
+		var err error
+		if alias, err = validateAlias(alias, s.gen.Format()); err != nil {
+			return domain.ShortenResult{}, err
+		}
+	}
+	originalURL, err := s.checkURL(ctx, alias, opts.Host, originalURL)
+	if err != nil {
+		return domain.ShortenResult{}, err
+	}
+	expiresAt := opts.ExpiresAt
+	if err := s.checkExpiry(expiresAt); err != nil {
+		return domain.ShortenResult{}, err
+	}
+	status, err := s.redirectStatus(opts.RedirectStatus, expiresAt)
+	if err != nil {
+		return domain.ShortenResult{}, err
+	}
+	created := func(code string) domain.ShortenResult {
+		return domain.ShortenResult{Code: code, ExpiresAt: expiresAt, RedirectStatus: status}
+	}
+	target := domain.Redirect{URL: originalURL, Status: status}
+
+	if alias != "" {
+		code, err := s.shortenAlias(ctx, alias, target, expiresAt)
+		return created(code), err
+	}
+
+	if s.dedup && expiresAt == nil {
+		code, ok, err := s.findExisting(ctx, target)
+		if err != nil {
+			s.logger.Error("dedup lookup failed", "err", err)
+			return domain.ShortenResult{}, err
+		}
+		if ok {
+			s.logger.Info("short url reused", "code", code, "originalURL", originalURL)
+			return domain.ShortenResult{Code: code, RedirectStatus: status, Existing: true}, nil
+		}
+	}
+
+	if s.writeBehind != nil {
+		code, err := s.writeBehind.Create(ctx, originalURL, expiresAt, status)
+		if err != nil {
+			s.logger.Error("write-behind create failed", "err", err)
+			return domain.ShortenResult{}, err
+		}
+		s.cache.Set(code, target, expiresAt)
+		s.logger.Info("short url created", "code", code, "originalURL", originalURL, "async", true)
+		return created(code), nil
+	}
+
+	for {
+		used := s.adaptive.length()
+		code, collisions, err := s.createGenerated(ctx, target, expiresAt)
+		exhausted := errors.Is(err, errKeyspaceCrowded)
+		if s.adaptive.observe(used, collisions, exhausted) {
+			s.logger.Warn("short code length increased", "length", s.adaptive.length(), "collisions", collisions)
+			if exhausted {
+				// повторяем с более длинными кодами вместо ошибки
+				continue
+			}
+		}
+		if err != nil {
+			if !exhausted {
+				s.logger.Error("failed to create short url", "err", err)
+			}
+			return domain.ShortenResult{}, err
+		}
+		return created(code), nil
+	}
 }
 
-func NewURLService(repo domain.URLRepository, cache *cache.URLCache, logger *slog.Logger) domain.URLService {
-	return &urlService{repo: repo, cache: cache, logger: logger}
+// redirectStatus выбирает статус редиректа новой ссылки. Ссылка со сроком
+// жизни не может быть постоянным редиректом: браузер запомнит его навсегда.
+func (s *urlService) redirectStatus(requested int, expiresAt *time.Time) (int, error) {
+	if requested == 0 {
+		status := s.defaultRedirect
+		if expiresAt != nil && domain.PermanentRedirect(status) {
+			status = http.StatusFound
+		}
+		return status, nil
+	}
+	if !domain.ValidRedirectStatus(requested) {
+		return 0, fmt.Errorf("%w: %d (want 301, 302, 307 or 308)", domain.ErrInvalidRedirect, requested)
+	}
+	if expiresAt != nil && domain.PermanentRedirect(requested) {
+		return 0, fmt.Errorf("%w: permanent redirect %d cannot be used for a link with expiration", domain.ErrInvalidRedirect, requested)
+	}
+	return requested, nil
 }
 
-func (s *urlService) Shorten(ctx context.Context, originalURL string, expiresAt *time.Time) (string, error) {
+// checkURL нормализует адрес назначения и проверяет его по политике и на
+// ссылки на самого себя. own — код создаваемой или изменяемой ссылки
+// (пусто, если он ещё не известен), host — хост запроса.
+func (s *urlService) checkURL(ctx context.Context, own, host, rawURL string) (string, error) {
+	norm, err := s.urls.normalize(rawURL)
+	if err != nil {
+		return "", err
+	}
+	// свой домен проверяем раньше политики: иначе ссылка на локальный
+	// BaseURL отвергалась бы с менее понятной причиной
+	if err := s.checkSelfLink(ctx, own, host, norm); err != nil {
+		return "", err
+	}
+	if s.policy != nil {
+		if d := s.policy.CheckURL(norm); !d.Allowed {
+			s.logger.Warn("destination rejected by policy", "originalURL", norm, "rule", d.Rule)
+			return "", invalidURL(RulePolicy, "destination host is not allowed")
+		}
+	}
+	return norm, nil
+}
+
+// blocked проверяет адрес ссылки по политике при переходе.
+func (s *urlService) blocked(code, originalURL string) bool {
+	if s.policy == nil {
+		return false
+	}
+	d := s.policy.CheckURL(originalURL)
+	if !d.Allowed {
+		s.logger.Warn("redirect blocked by policy", "code", code, "originalURL", originalURL, "rule", d.Rule)
+	}
+	return !d.Allowed
+}
+
+// findExisting ищет действующую бессрочную ссылку на тот же адрес с тем же
+// статусом редиректа. Ссылки со сроком жизни не переиспользуются: запрос без
+// срока ждёт бессрочную ссылку, а запрос со сроком до сюда не доходит.
+func (s *urlService) findExisting(ctx context.Context, target domain.Redirect) (string, bool, error) {
+	hash := domain.URLHash(target.URL)
+	urls, err := s.repo.FindByURLHash(ctx, hash)
+	if err != nil {
+		return "", false, err
+	}
+	if s.writeBehind != nil {
+		// ссылка могла быть только что создана и ещё не записана
+		urls = append(urls, s.writeBehind.PendingByURLHash(hash)...)
+	}
+	for _, u := range urls {
+		if u.OriginalURL == target.URL && u.ExpiresAt == nil && u.Redirect().Status == target.Status {
+			return u.Code, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// errKeyspaceCrowded — все попытки создать код упёрлись в коллизии.
+var errKeyspaceCrowded = errors.New("short code keyspace is crowded")
+
+// createGenerated создаёт ссылку со сгенерированным кодом, повторяя при
+// коллизиях. Возвращает число коллизий.
+func (s *urlService) createGenerated(ctx context.Context, target domain.Redirect, expiresAt *time.Time) (string, int, error) {
 	const (
-		codeLen     = 8
 		maxAttempts = 5
+		// maxRejected защищает от бесконечного цикла, если фильтр отвергает всё подряд
+		maxRejected = 100
 	)
 
-	var lastErr error
-	for i := 0; i < maxAttempts; i++ {
-		code := generateCode(codeLen)
+	collisions, rejected := 0, 0
+	for attempt := 0; collisions < maxAttempts; attempt++ {
+		// для генераторов с гарантированной уникальностью повтор возможен
+		// только при совпадении с алиасом
+		code := s.gen.Generate(target.URL, attempt)
 
-		err := s.repo.Create(ctx, code, originalURL, expiresAt)
+		if !acceptableCode(s.filter, code) {
+			s.rejected.Add(1)
+			if rejected++; rejected >= maxRejected {
+				return "", collisions, fmt.Errorf("failed to generate acceptable short code: %d candidates rejected by filter", rejected)
+			}
+			continue
+		}
+
+		s.attempts.Add(1)
+		err := s.repo.Create(ctx, code, target.URL, expiresAt, target.Status)
 		if err == nil {
-			s.cache.Set(code, originalURL)
-			s.logger.Info("short url created", "code", code, "originalURL", originalURL)
-			return code, nil
+			s.cache.Set(code, target, expiresAt)
+			s.logger.Info("short url created", "code", code, "originalURL", target.URL)
+			return code, collisions, nil
 		}
 
 		if errors.Is(err, domain.ErrCodeAlreadyExists) {
 			// Коллизия при многопоточности — генерируем новый код
-			lastErr = err
+			s.collisions.Add(1)
+			collisions++
 			continue
 		}
 
 		// другая ошибка — выходим
-		s.logger.Error("failed to create short url: %v", "err", err)
+		return "", collisions, err
+	}
+
+	return "", collisions, fmt.Errorf("failed to generate unique short code after %d attempts: %w", maxAttempts, errKeyspaceCrowded)
+}
+
+// shortenAlias создаёт ссылку с пользовательским кодом. Коллизия здесь — ошибка
+// клиента, поэтому без повторов: ErrCodeAlreadyExists возвращается как есть.
+// alias уже проверен и приведён к каноническому виду.
+func (s *urlService) shortenAlias(ctx context.Context, alias string, target domain.Redirect, expiresAt *time.Time) (string, error) {
+	create := s.repo.Create
+	if s.writeBehind != nil {
+		// код может быть уже выдан асинхронно, но ещё не записан
+		create = s.writeBehind.CreateAlias
+	}
+	if err := create(ctx, alias, target.URL, expiresAt, target.Status); err != nil {
+		if !errors.Is(err, domain.ErrCodeAlreadyExists) {
+			s.logger.Error("failed to create alias", "alias", alias, "err", err)
+		}
 		return "", err
 	}
 
-	return "", fmt.Errorf("failed to generate unique short code after %d attempts: %w", maxAttempts, lastErr)
+	s.cache.Set(alias, target, expiresAt)
+	s.logger.Info("short url created", "code", alias, "originalURL", target.URL, "alias", true)
+	return alias, nil
 }
 
-func (s *urlService) Resolve(ctx context.Context, code string) (string, error) {
-	if url, ok := s.cache.Get(code); ok {
+func (s *urlService) Resolve(ctx context.Context, code string, v domain.Visitor) (domain.Redirect, error) {
+	if r, ok := s.cache.Get(code); ok {
 		s.logger.Debug("cache hit: code", "code", code)
-		// статистику можно считать асинхронно
-		go func() {
-			//отправим, например в сервис статистики или в очередь, чтобы потом батчами записывать в кликхаус
-		}()
-		return url, nil
+		if s.blocked(code, r.URL) {
+			return domain.Redirect{}, domain.ErrURLBlocked
+		}
+		s.recordClick(code, v)
+		return r, nil
 	}
 
 	s.logger.Debug("cache miss: code", "code", code)
 
-	u, err := s.repo.GetByCode(ctx, code)
+	gen := s.cache.Generation()
+	u, err := s.getByCode(ctx, code)
 	if err != nil {
-		if errors.Is(err, domain.ErrURLNotFound) {
-			return "", domain.ErrURLNotFound
+		// для редиректа истёкшая ссылка неотличима от несуществующей
+		if errors.Is(err, domain.ErrURLNotFound) || errors.Is(err, domain.ErrURLExpired) {
+			return domain.Redirect{}, s.notFound(ctx, code)
 		}
-		return "", err
+		return domain.Redirect{}, err
+	}
+	if u.Disabled {
+		return domain.Redirect{}, domain.ErrURLDisabled
 	}
 
-	s.cache.Set(code, u.OriginalURL)
-	go func() {
-		//отправим, например в сервис статистики или в очередь, чтобы потом батчами записывать в кликхаус
-	}()
+	r := u.Redirect()
+	s.cache.SetIfGen(code, r, u.ExpiresAt, gen)
+	if s.blocked(code, r.URL) {
+		return domain.Redirect{}, domain.ErrURLBlocked
+	}
+	s.recordClick(code, v)
 
-	return u.OriginalURL, nil
+	return r, nil
+}
+
+// maxSuggestions ограничивает подсказки «возможно, вы имели в виду».
+const maxSuggestions = 3
+
+// notFound отличает опечатку от неизвестного кода: если включён контрольный
+// символ и код его не проходит, ищет существующие коды на расстоянии одной
+// правки.
+func (s *urlService) notFound(ctx context.Context, code string) error {
+	f := s.gen.Format()
+	if f.Valid(code) {
+		return domain.ErrURLNotFound
+	}
+
+	typo := &domain.TypoError{Code: code}
+	for _, c := range f.Corrections(code) {
+		u, err := s.getByCode(ctx, c)
+		if err != nil || u.Disabled {
+			continue
+		}
+		typo.Suggestions = append(typo.Suggestions, c)
+		if len(typo.Suggestions) == maxSuggestions {
+			break
+		}
+	}
+	return typo
+}
+
+func (s *urlService) recordClick(code string, v domain.Visitor) {
+	if s.clicks != nil {
+		s.clicks.Record(domain.ClickEvent{Code: code, At: time.Now().UTC(), Visitor: v})
+	}
+}
+
+func (s *urlService) GetLink(ctx context.Context, code string) (*domain.URL, error) {
+	return s.getByCode(ctx, code)
+}
+
+// getByCode читает ссылку из хранилища, а если её там ещё нет —
+// из очереди асинхронной записи.
+func (s *urlService) getByCode(ctx context.Context, code string) (*domain.URL, error) {
+	u, err := s.repo.GetByCode(ctx, code)
+	if err == nil || s.writeBehind == nil || !errors.Is(err, domain.ErrURLNotFound) {
+		return u, err
+	}
+
+	p, ok := s.writeBehind.Pending(code)
+	if !ok {
+		return nil, err
+	}
+	if p.ExpiresAt != nil && time.Now().After(*p.ExpiresAt) {
+		return nil, domain.ErrURLExpired
+	}
+	return &p, nil
+}
+
+// persistPending дописывает в хранилище ссылку, ожидающую асинхронной записи:
+// удаление и изменения применяются только к хранилищу, и без этого только
+// что созданная ссылка продолжала бы открываться, а затем записалась бы как есть.
+func (s *urlService) persistPending(ctx context.Context, code string) error {
+	if s.writeBehind == nil {
+		return nil
+	}
+	return s.writeBehind.Persist(ctx, code)
+}
+
+func (s *urlService) DeleteLink(ctx context.Context, code string) error {
+	if err := s.persistPending(ctx, code); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, code); err != nil {
+		return err
+	}
+	s.cache.Delete(code)
+	s.logger.Info("short url deleted", "code", code)
+	return nil
+}
+
+func (s *urlService) DisableLink(ctx context.Context, code, reason string) error {
+	if err := s.persistPending(ctx, code); err != nil {
+		return err
+	}
+	if err := s.repo.Disable(ctx, code, reason); err != nil {
+		return err
+	}
+	s.cache.Delete(code)
+	s.logger.Info("short url disabled", "code", code, "reason", reason)
+	return nil
+}
+
+func (s *urlService) EnableLink(ctx context.Context, code string) error {
+	if err := s.persistPending(ctx, code); err != nil {
+		return err
+	}
+	if err := s.repo.Enable(ctx, code); err != nil {
+		return err
+	}
+	s.logger.Info("short url enabled", "code", code)
+	return nil
+}
+
+// UpdateLink меняет адрес назначения и/или отключает ссылку одной записью в
+// хранилище. Кэш сбрасывается до возврата, поэтому после успешного ответа
+// старый адрес уже не будет отдан.
+func (s *urlService) UpdateLink(ctx context.Context, code string, upd domain.LinkUpdate, ifVersion int64) error {
+	if upd.OriginalURL != nil {
+		originalURL, err := s.checkURL(ctx, code, upd.Host, *upd.OriginalURL)
+		if err != nil {
+			return err
+		}
+		upd.OriginalURL = &originalURL
+	}
+	if err := s.persistPending(ctx, code); err != nil {
+		return err
+	}
+	if err := s.repo.Update(ctx, code, upd, ifVersion); err != nil {
+		return err
+	}
+	s.cache.Delete(code)
+
+	attrs := []any{"code", code}
+	if upd.OriginalURL != nil {
+		attrs = append(attrs, "originalURL", *upd.OriginalURL)
+	}
+	if upd.Disabled != nil {
+		attrs = append(attrs, "disabled", *upd.Disabled)
+	}
+	s.logger.Info("short url updated", attrs...)
+	return nil
+}
+
+// checkExpiry проверяет, что срок жизни в будущем и не превышает maxTTL.
+func (s *urlService) checkExpiry(expiresAt *time.Time) error {
+	if expiresAt == nil {
+		return nil
+	}
+
+	ttl := time.Until(*expiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("%w: must be in the future", domain.ErrInvalidExpiry)
+	}
+	if s.maxTTL > 0 && ttl > s.maxTTL {
+		return fmt.Errorf("%w: exceeds max ttl %s", domain.ErrInvalidExpiry, s.maxTTL)
+	}
+	return nil
 }
 
 var _ domain.URLService = (*urlService)(nil)
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"shortener/internal/domain"
+	"shortener/internal/hll"
+	"shortener/internal/trending"
+)
+
+const (
+	maxStatsPeriod = 90 * 24 * time.Hour
+	statsTopN      = 10
+
+	maxTrendingLimit = 100
+)
+
+func (s *urlService) Stats(ctx context.Context, code string, from, to time.Time) (*domain.LinkStats, error) {
+	if s.analytics == nil {
+		return nil, domain.ErrStatsDisabled
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from must be before to", domain.ErrInvalidPeriod)
+	}
+	if to.Sub(from) > maxStatsPeriod {
+		return nil, fmt.Errorf("%w: period exceeds %s", domain.ErrInvalidPeriod, maxStatsPeriod)
+	}
+
+	// статистика истёкших и отключённых ссылок остаётся доступной
+	if _, err := s.getByCode(ctx, code); err != nil && !errors.Is(err, domain.ErrURLExpired) {
+		return nil, err
+	}
+
+	st, err := s.analytics.ClickStats(ctx, code, from.UTC(), to.UTC(), statsTopN)
+	if err != nil {
+		return nil, err
+	}
+	st.Hourly = fillBuckets(st.Hourly, from, to, time.Hour)
+	st.Daily = fillBuckets(st.Daily, from, to, 24*time.Hour)
+
+	if err := s.fillUniques(ctx, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// fillUniques проставляет уникальных посетителей по дням и за весь период,
+// объединяя дневные HyperLogLog-скетчи.
+func (s *urlService) fillUniques(ctx context.Context, st *domain.LinkStats) error {
+	sketches, err := s.analytics.Sketches(ctx, st.Code, st.From, st.To)
+	if err != nil {
+		return err
+	}
+
+	byDay := make(map[int64]int64, len(sketches))
+	total := hll.New(hll.DefaultPrecision)
+	for _, ds := range sketches {
+		sk, err := hll.Decode(ds.Sketch)
+		if err != nil {
+			return err
+		}
+		byDay[ds.Day.Unix()] = int64(sk.Estimate())
+		if err := total.Merge(sk); err != nil {
+			return err
+		}
+	}
+
+	for i := range st.Daily {
+		st.Daily[i].Uniques = byDay[st.Daily[i].Start.Unix()]
+	}
+	st.UniqueVisitors = int64(total.Estimate())
+	return nil
+}
+
+// fillBuckets дополняет разреженный ряд нулевыми интервалами, чтобы график был непрерывным.
+func fillBuckets(sparse []domain.StatsBucket, from, to time.Time, step time.Duration) []domain.StatsBucket {
+	byStart := make(map[int64]int64, len(sparse))
+	for _, b := range sparse {
+		byStart[b.Start.Unix()] = b.Clicks
+	}
+
+	start := from.UTC().Truncate(step)
+	out := make([]domain.StatsBucket, 0, int(to.Sub(start)/step)+1)
+	for t := start; t.Before(to); t = t.Add(step) {
+		out = append(out, domain.StatsBucket{Start: t, Clicks: byStart[t.Unix()]})
+	}
+	return out
+}
+
+func (s *urlService) Trending(ctx context.Context, window time.Duration, limit int) ([]domain.TrendingLink, error) {
+	if s.trending == nil {
+		return nil, domain.ErrTrendingDisabled
+	}
+	if window <= 0 || window > trending.MaxWindow {
+		return nil, fmt.Errorf("%w: window must be in (0, %s]", domain.ErrInvalidPeriod, trending.MaxWindow)
+	}
+	if limit <= 0 || limit > maxTrendingLimit {
+		limit = maxTrendingLimit
+	}
+
+	top := s.trending.Top(window, limit, time.Now())
+	out := make([]domain.TrendingLink, len(top))
+	for i, e := range top {
+		out[i] = domain.TrendingLink{Code: e.Code, Clicks: e.Clicks}
+	}
+	return out, nil
+}
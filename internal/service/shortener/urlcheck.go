@@ -0,0 +1,180 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"shortener/internal/domain"
+	"shortener/internal/punycode"
+)
+
+// Правила проверки адреса назначения (domain.URLError.Rule).
+const (
+	RuleLength   = "length"
+	RuleSyntax   = "syntax"
+	RuleScheme   = "scheme"
+	RuleHost     = "host"
+	RulePort     = "port"
+	RuleUserinfo = "userinfo"
+	RulePolicy   = "policy"
+)
+
+// DefaultMaxURLLength — ограничение длины адреса по умолчанию.
+const DefaultMaxURLLength = 2048
+
+// urlRules — проверка и нормализация адресов назначения.
+type urlRules struct {
+	schemes   map[string]struct{}
+	maxLength int
+}
+
+func newURLRules(schemes []string, maxLength int) urlRules {
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+	if maxLength <= 0 {
+		maxLength = DefaultMaxURLLength
+	}
+	r := urlRules{schemes: make(map[string]struct{}, len(schemes)), maxLength: maxLength}
+	for _, sc := range schemes {
+		r.schemes[strings.ToLower(strings.TrimSpace(sc))] = struct{}{}
+	}
+	return r
+}
+
+// defaultPorts — порты, которые не пишутся в нормализованном адресе.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+func invalidURL(rule, format string, args ...any) error {
+	return &domain.URLError{Rule: rule, Reason: fmt.Sprintf(format, args...)}
+}
+
+// normalize проверяет адрес и приводит его к каноническому виду: схема и
+// хост в нижнем регистре, IDN — в punycode, без порта по умолчанию и
+// завершающей точки хоста, пустой путь — "/". Путь, запрос и фрагмент не
+// меняются.
+func (r urlRules) normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if len(raw) > r.maxLength {
+		return "", invalidURL(RuleLength, "url is longer than %d bytes", r.maxLength)
+	}
+	for _, c := range raw {
+		if c < 0x20 || c == 0x7f || c == ' ' {
+			return "", invalidURL(RuleSyntax, "url contains whitespace or control characters")
+		}
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", invalidURL(RuleSyntax, "url cannot be parsed")
+	}
+	if u.Scheme == "" {
+		return "", invalidURL(RuleScheme, "url must be absolute")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := r.schemes[u.Scheme]; !ok {
+		return "", invalidURL(RuleScheme, "scheme %q is not allowed", u.Scheme)
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return "", invalidURL(RuleHost, "host is required")
+	}
+	if u.User != nil {
+		return "", invalidURL(RuleUserinfo, "credentials in url are not allowed")
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	port := u.Port()
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", invalidURL(RulePort, "port %q is out of range", port)
+		}
+		if defaultPorts[u.Scheme] == port {
+			port = ""
+		}
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	out := u.String()
+	if len(out) > r.maxLength {
+		return "", invalidURL(RuleLength, "url is longer than %d bytes", r.maxLength)
+	}
+	return out, nil
+}
+
+// normalizeHost проверяет имя хоста или IP-адрес и возвращает его в
+// каноническом виде.
+func normalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", invalidURL(RuleHost, "host is required")
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if ip.Zone() != "" {
+			return "", invalidURL(RuleHost, "ipv6 zones are not allowed")
+		}
+		return ip.String(), nil
+	}
+
+	host = strings.TrimSuffix(host, ".")
+	ascii, err := punycode.ToASCII(host)
+	if err != nil {
+		return "", invalidURL(RuleHost, "host %q is not a valid domain name", host)
+	}
+	if len(ascii) > 253 {
+		return "", invalidURL(RuleHost, "host is longer than 253 bytes")
+	}
+	labels := strings.Split(ascii, ".")
+	for _, label := range labels {
+		if !validLabel(label) {
+			return "", invalidURL(RuleHost, "host %q is not a valid domain name", host)
+		}
+	}
+	// браузеры читают такие хосты (2130706433, 0x7f.1) как IPv4-адрес
+	if numericLabel(labels[len(labels)-1]) {
+		return "", invalidURL(RuleHost, "host %q is an ambiguous ip address", host)
+	}
+	return ascii, nil
+}
+
+// validLabel — метка DNS: 1–63 символа из букв, цифр, дефиса и
+// подчёркивания, без дефиса по краям.
+func validLabel(l string) bool {
+	if l == "" || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(l); i++ {
+		c := l[i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func numericLabel(l string) bool {
+	if strings.HasPrefix(l, "0x") {
+		return true
+	}
+	for i := 0; i < len(l); i++ {
+		if l[i] < '0' || l[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,634 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"shortener/internal/domain"
+	"shortener/internal/journal"
+)
+
+type WriteBehindConfig struct {
+	PoolSize      int           // сколько заранее зарезервированных кодов держать наготове
+	QueueSize     int           // ёмкость очереди на запись
+	BatchSize     int           // максимальный размер пачки для CreateBatch
+	FlushInterval time.Duration // как часто сбрасывать неполную пачку
+
+	// Generator выдаёт коды, по умолчанию — 8 случайных символов. Пул заранее
+	// проверенных кодов нужен только случайному генератору: уникальные
+	// генераторы не повторяются, а коды из хэша зависят от адреса. Коды не
+	// из пула перед выдачей сверяются с хранилищем — их мог занять алиас.
+	Generator CodeGenerator
+	// Filter отбраковывает нежелательные коды, как WithCodeFilter у сервиса.
+	Filter CodeFilter
+}
+
+// WriteBehindStats — метрики асинхронного создания.
+type WriteBehindStats struct {
+	PoolSize       int   `json:"pool_size"`
+	QueueDepth     int   `json:"queue_depth"`
+	Pending        int   `json:"pending"`
+	Persisted      int64 `json:"persisted"`
+	Conflicts      int64 `json:"conflicts"`
+	FlushErrors    int64 `json:"flush_errors"`
+	SyncFallbacks  int64 `json:"sync_fallbacks"`
+	PoolMisses     int64 `json:"pool_misses"`
+	Rejected       int64 `json:"rejected"`
+	JournalRecords int64 `json:"journal_records"`
+
+	Journal journal.Stats `json:"journal"`
+}
+
+// WriteBehind отвечает клиенту до записи в БД: код берётся из пула заранее
+// проверенных, ссылка пишется в журнал (fsync) и кэш, а в хранилище уходит
+// пачкой в фоне. Журнал проигрывается при старте через Recover.
+type WriteBehind struct {
+	repo    domain.URLRepository
+	journal *journal.Journal
+	logger  *slog.Logger
+	cfg     WriteBehindConfig
+
+	pool  chan string
+	queue chan domain.URL
+
+	// pending — созданные, но ещё не сохранённые ссылки; по ним отвечает Resolve
+	// и их коды не выдаются повторно из пула. pooled — коды в пуле, ещё никому
+	// не выданные; CreateAlias снимает отсюда код, который занял алиас.
+	// byHash — коды ожидающих ссылок по domain.URLHash адреса, для дедупликации.
+	mu      sync.RWMutex
+	pending map[string]domain.URL
+	pooled  map[string]struct{}
+	byHash  map[string][]string
+
+	// writeMu не даёт фоновой записи и Persist записать одну ссылку дважды.
+	writeMu sync.Mutex
+
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	// stopCtx отменяется, если Close не дождался фоновой записи.
+	stopCtx context.Context
+	abort   context.CancelFunc
+
+	persisted      atomic.Int64
+	conflicts      atomic.Int64
+	flushErrors    atomic.Int64
+	syncFallbacks  atomic.Int64
+	poolMisses     atomic.Int64
+	rejected       atomic.Int64
+	journalRecords atomic.Int64
+}
+
+func NewWriteBehind(repo domain.URLRepository, j *journal.Journal, cfg WriteBehindConfig, logger *slog.Logger) *WriteBehind {
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 1024
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 10_000
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 100 * time.Millisecond
+	}
+	if cfg.Generator == nil {
+		cfg.Generator = NewRandomGenerator(8)
+	}
+	stopCtx, abort := context.WithCancel(context.Background())
+	return &WriteBehind{
+		repo:    repo,
+		journal: j,
+		logger:  logger,
+		cfg:     cfg,
+		pool:    make(chan string, cfg.PoolSize),
+		queue:   make(chan domain.URL, cfg.QueueSize),
+		pending: make(map[string]domain.URL),
+		pooled:  make(map[string]struct{}),
+		byHash:  make(map[string][]string),
+		done:    make(chan struct{}),
+		stopCtx: stopCtx,
+		abort:   abort,
+	}
+}
+
+// Recover дозаписывает в хранилище всё, что осталось в журнале с прошлого
+// запуска. Вызывается до Start.
+func (w *WriteBehind) Recover(ctx context.Context) (int, error) {
+	return journal.Replay(ctx, w.journal, w.repo)
+}
+
+// Start запускает пополнение пула кодов и фоновую запись.
+func (w *WriteBehind) Start() {
+	if w.usesPool() {
+		w.wg.Add(1)
+		go w.fillPool()
+	}
+	w.wg.Add(1)
+	go w.flushLoop()
+}
+
+// Create выполняет асинхронное создание ссылки и возвращает код.
+func (w *WriteBehind) Create(ctx context.Context, originalURL string, expiresAt *time.Time, redirectStatus int) (string, error) {
+	u := domain.URL{
+		OriginalURL: originalURL,
+		ExpiresAt:   expiresAt,
+		CreatedAt:   time.Now().UTC(),
+		Version:     1,
+
+		RedirectStatus: redirectStatus,
+	}
+	code, err := w.reserveCode(ctx, u)
+	if err != nil {
+		return "", err
+	}
+	u.Code = code
+
+	if err := w.journal.Append(journal.Record{
+		Code:      u.Code,
+		URL:       u.OriginalURL,
+		ExpiresAt: u.ExpiresAt,
+		CreatedAt: u.CreatedAt,
+
+		RedirectStatus: u.RedirectStatus,
+	}); err != nil {
+		w.release(code)
+		return "", err
+	}
+	w.journalRecords.Add(1)
+
+	select {
+	case w.queue <- u:
+		return code, nil
+	default:
+	}
+
+	// очередь переполнена — пишем синхронно, чтобы не копить бесконечный хвост
+	w.syncFallbacks.Add(1)
+	skipped, err := w.persist(ctx, []domain.URL{u})
+	if err != nil {
+		// клиент получит ошибку — ссылка не должна ни открываться, ни
+		// восстановиться из журнала при следующем старте
+		w.rollback(code)
+		return "", err
+	}
+	if len(skipped) > 0 {
+		return "", domain.ErrCodeAlreadyExists
+	}
+	return code, nil
+}
+
+// CreateAlias сохраняет ссылку с пользовательским кодом сразу в хранилище,
+// следя, чтобы код не совпал с уже выданной, но ещё не записанной ссылкой.
+// Create и пополнение пула занимают код до проверки хранилища, а здесь
+// ожидающие и пул проверяются после записи, поэтому из двух одновременных
+// запросов на один код хотя бы один увидит другой. Ещё не выданный код из
+// пула уступает алиасу. writeMu не даёт фоновой записи вклиниться между ними.
+func (w *WriteBehind) CreateAlias(ctx context.Context, code, originalURL string, expiresAt *time.Time, redirectStatus int) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	if _, ok := w.Pending(code); ok {
+		return domain.ErrCodeAlreadyExists
+	}
+	if err := w.repo.Create(ctx, code, originalURL, expiresAt, redirectStatus); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	_, pending := w.pending[code]
+	if !pending {
+		delete(w.pooled, code)
+	}
+	w.mu.Unlock()
+	if pending {
+		// код только что выдан асинхронно и уже у клиента — уступаем ему
+		if err := w.repo.Delete(ctx, code); err != nil {
+			return err
+		}
+		return domain.ErrCodeAlreadyExists
+	}
+	return nil
+}
+
+// Persist сразу записывает ожидающую ссылку в хранилище, чтобы её можно было
+// удалить, отключить или изменить. Для остальных кодов ничего не делает.
+func (w *WriteBehind) Persist(ctx context.Context, code string) error {
+	u, ok := w.Pending(code)
+	if !ok {
+		return nil
+	}
+	skipped, err := w.persist(ctx, []domain.URL{u})
+	if err != nil {
+		return err
+	}
+	w.lost(skipped)
+	return nil
+}
+
+// Pending возвращает ссылку, которая создана, но ещё не записана в хранилище.
+func (w *WriteBehind) Pending(code string) (domain.URL, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	u, ok := w.pending[code]
+	return u, ok
+}
+
+// PendingByURLHash возвращает ожидающие записи ссылки с данным хэшем адреса,
+// как FindByURLHash у хранилища.
+func (w *WriteBehind) PendingByURLHash(hash string) []domain.URL {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	var urls []domain.URL
+	for _, code := range w.byHash[hash] {
+		urls = append(urls, w.pending[code])
+	}
+	return urls
+}
+
+// IncrementClicks прибавляет клики в хранилище, предварительно дописав
+// ожидающие ссылки: иначе клики по только что созданной ссылке не найдут
+// строку и потеряются.
+func (w *WriteBehind) IncrementClicks(ctx context.Context, deltas map[string]int64) error {
+	var urls []domain.URL
+	w.mu.RLock()
+	for code := range deltas {
+		if u, ok := w.pending[code]; ok {
+			urls = append(urls, u)
+		}
+	}
+	w.mu.RUnlock()
+
+	if len(urls) > 0 {
+		skipped, err := w.persist(ctx, urls)
+		if err != nil {
+			return err
+		}
+		w.lost(skipped)
+	}
+	return w.repo.IncrementClicks(ctx, deltas)
+}
+
+func (w *WriteBehind) usesPool() bool {
+	_, ok := w.cfg.Generator.(*RandomGenerator)
+	return ok
+}
+
+// maxReserveAttempts ограничивает подбор кода: если фильтр отвергает всё
+// подряд или все кандидаты заняты, Create вернёт ошибку, а не зациклится.
+const maxReserveAttempts = 100
+
+// reserveCode подбирает свободный код и занимает его среди ожидающих записи
+// ссылкой u. Код из пула уже проверен по хранилищу, а занявший его алиас
+// снимает код с пула, так что в БД за ним не ходим. Остальные коды
+// занимаются до проверки хранилища — на это опирается CreateAlias. Ошибка
+// хранилища прерывает подбор: иначе при недоступной БД каждый кандидат
+// выглядел бы занятым.
+func (w *WriteBehind) reserveCode(ctx context.Context, u domain.URL) (string, error) {
+	for attempt := 0; attempt < maxReserveAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		code, fromPool, ok := w.candidate(u.OriginalURL, attempt)
+		if !ok {
+			continue
+		}
+		u.Code = code
+		if !w.claim(u, fromPool) {
+			continue
+		}
+		if fromPool {
+			return code, nil
+		}
+		taken, err := w.stored(ctx, code)
+		if err != nil {
+			w.release(code)
+			return "", err
+		}
+		if !taken {
+			return code, nil
+		}
+		w.release(code)
+	}
+	return "", fmt.Errorf("write-behind: no free short code after %d attempts", maxReserveAttempts)
+}
+
+// candidate возвращает очередной код и признак, что он взят из пула: первым —
+// из пула, если он есть, иначе сгенерированный на месте. false — код
+// отвергнут фильтром.
+func (w *WriteBehind) candidate(originalURL string, attempt int) (string, bool, bool) {
+	if attempt == 0 && w.usesPool() {
+		select {
+		case code := <-w.pool:
+			return code, true, true
+		default:
+		}
+		w.poolMisses.Add(1)
+	}
+	code := w.cfg.Generator.Generate(originalURL, attempt)
+	return code, false, w.acceptable(code)
+}
+
+// claim заносит u в ожидающие записи. false — код уже занят другой ожидающей
+// ссылкой или, если он из пула, отдан алиасу.
+func (w *WriteBehind) claim(u domain.URL, fromPool bool) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if fromPool {
+		if _, ok := w.pooled[u.Code]; !ok {
+			return false
+		}
+		delete(w.pooled, u.Code)
+	}
+	if _, ok := w.pending[u.Code]; ok {
+		return false
+	}
+	w.pending[u.Code] = u
+	hash := domain.URLHash(u.OriginalURL)
+	w.byHash[hash] = append(w.byHash[hash], u.Code)
+	return true
+}
+
+// unpend снимает код с ожидания. Вызывается под mu.
+func (w *WriteBehind) unpend(code string) {
+	u, ok := w.pending[code]
+	if !ok {
+		return
+	}
+	delete(w.pending, code)
+	hash := domain.URLHash(u.OriginalURL)
+	codes := slices.DeleteFunc(w.byHash[hash], func(c string) bool { return c == code })
+	if len(codes) == 0 {
+		delete(w.byHash, hash)
+	} else {
+		w.byHash[hash] = codes
+	}
+}
+
+// reservePool занимает код для пула. false — код уже в пуле или ожидает записи.
+func (w *WriteBehind) reservePool(code string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.pending[code]; ok {
+		return false
+	}
+	if _, ok := w.pooled[code]; ok {
+		return false
+	}
+	w.pooled[code] = struct{}{}
+	return true
+}
+
+func (w *WriteBehind) unpool(code string) {
+	w.mu.Lock()
+	delete(w.pooled, code)
+	w.mu.Unlock()
+}
+
+// release снимает код с ожидания, не записывая ссылку.
+func (w *WriteBehind) release(code string) {
+	w.mu.Lock()
+	w.unpend(code)
+	w.mu.Unlock()
+}
+
+// rollback отменяет созданную ссылку целиком: снимает с ожидания и
+// отмечает в журнале, чтобы она не проигралась при следующем старте.
+func (w *WriteBehind) rollback(code string) {
+	w.release(code)
+	if err := w.journal.Confirm(code); err != nil {
+		w.logger.Error("journal rollback failed", "code", code, "err", err)
+	}
+}
+
+func (w *WriteBehind) acceptable(code string) bool {
+	if acceptableCode(w.cfg.Filter, code) {
+		return true
+	}
+	w.rejected.Add(1)
+	return false
+}
+
+// stored проверяет, занят ли код в хранилище. Истёкшая ссылка код по-прежнему занимает.
+func (w *WriteBehind) stored(ctx context.Context, code string) (bool, error) {
+	_, err := w.repo.GetByCode(ctx, code)
+	switch {
+	case errors.Is(err, domain.ErrURLNotFound):
+		return false, nil
+	case err == nil || errors.Is(err, domain.ErrURLExpired):
+		return true, nil
+	default:
+		return false, err
+	}
+}
+
+// Пауза пополнения пула после ошибки хранилища, удваивается до максимума.
+const (
+	poolRetryMin = 50 * time.Millisecond
+	poolRetryMax = 5 * time.Second
+)
+
+func (w *WriteBehind) fillPool() {
+	defer w.wg.Done()
+
+	retry := poolRetryMin
+	for {
+		select {
+		case <-w.done:
+			return
+		default:
+		}
+
+		code := w.cfg.Generator.Generate("", 0)
+		if !w.acceptable(code) || !w.reservePool(code) {
+			continue
+		}
+
+		// код занят в пуле до проверки хранилища — на это опирается CreateAlias
+		ctx, cancel := context.WithTimeout(w.stopCtx, time.Second)
+		taken, err := w.stored(ctx, code)
+		cancel()
+		if err != nil || taken {
+			w.unpool(code)
+		}
+		if err != nil {
+			w.logger.Warn("write-behind pool refill failed", "err", err, "retry_in", retry)
+			select {
+			case <-time.After(retry):
+			case <-w.done:
+				return
+			}
+			retry = min(retry*2, poolRetryMax)
+			continue
+		}
+		retry = poolRetryMin
+		if taken {
+			continue
+		}
+
+		select {
+		case w.pool <- code:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *WriteBehind) flushLoop() {
+	defer w.wg.Done()
+
+	t := time.NewTicker(w.cfg.FlushInterval)
+	defer t.Stop()
+
+	batch := make([]domain.URL, 0, w.cfg.BatchSize)
+	for {
+		queue := w.queue
+		if len(batch) >= w.cfg.BatchSize {
+			// пачка не записалась — новых ссылок не берём, пока она не уйдёт:
+			// очередь заполнится, и Create перейдёт на синхронную запись
+			queue = nil
+		}
+		select {
+		case u := <-queue:
+			batch = append(batch, u)
+			if len(batch) < w.cfg.BatchSize {
+				continue
+			}
+		case <-t.C:
+		case <-w.done:
+			// дописываем всё, что уже в очереди
+			for len(w.queue) > 0 {
+				batch = append(batch, <-w.queue)
+			}
+			w.flush(batch)
+			return
+		}
+
+		batch = w.flush(batch)
+	}
+}
+
+// flush пишет пачку. При ошибке возвращает её обратно для повтора: записи
+// остаются в журнале и в pending, так что клиенты их по-прежнему видят.
+func (w *WriteBehind) flush(batch []domain.URL) []domain.URL {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	ctx, cancel := context.WithTimeout(w.stopCtx, 5*time.Second)
+	defer cancel()
+
+	skipped, err := w.persist(ctx, batch)
+	if err != nil {
+		w.flushErrors.Add(1)
+		w.logger.Error("write-behind flush failed", "batch", len(batch), "err", err)
+		return batch
+	}
+	w.lost(skipped)
+	return batch[:0]
+}
+
+// persist записывает те ссылки из urls, что ещё ожидают записи (другие уже
+// записал Persist), и снимает их с ожидания. Возвращает занятые коды.
+func (w *WriteBehind) persist(ctx context.Context, urls []domain.URL) ([]string, error) {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	batch := make([]domain.URL, 0, len(urls))
+	w.mu.RLock()
+	for _, u := range urls {
+		if _, ok := w.pending[u.Code]; ok {
+			batch = append(batch, u)
+		}
+	}
+	w.mu.RUnlock()
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
+	skipped, err := w.repo.CreateBatch(ctx, batch)
+	if err != nil {
+		return nil, err
+	}
+	w.persisted.Add(int64(len(batch) - len(skipped)))
+	w.confirm(batch)
+	return skipped, nil
+}
+
+// lost учитывает коды, которые при записи оказались заняты другим экземпляром
+// сервиса (свои алиасы отсекает CreateAlias): клиент уже получил их,
+// восстановить ссылки автоматически нельзя.
+func (w *WriteBehind) lost(codes []string) {
+	for _, code := range codes {
+		w.conflicts.Add(1)
+		w.logger.Error("write-behind code conflict, link lost", "code", code)
+	}
+}
+
+// confirm снимает сохранённые ссылки с ожидания и отмечает их в журнале.
+func (w *WriteBehind) confirm(batch []domain.URL) {
+	codes := make([]string, len(batch))
+	w.mu.Lock()
+	for i, u := range batch {
+		codes[i] = u.Code
+		w.unpend(u.Code)
+	}
+	w.mu.Unlock()
+
+	if err := w.journal.Confirm(codes...); err != nil {
+		// не страшно: при следующем старте записи просто проиграются повторно
+		w.logger.Error("journal confirm failed", "err", err)
+	}
+}
+
+func (w *WriteBehind) Stats() WriteBehindStats {
+	w.mu.RLock()
+	pending := len(w.pending)
+	w.mu.RUnlock()
+
+	return WriteBehindStats{
+		PoolSize:       len(w.pool),
+		QueueDepth:     len(w.queue),
+		Pending:        pending,
+		Persisted:      w.persisted.Load(),
+		Conflicts:      w.conflicts.Load(),
+		FlushErrors:    w.flushErrors.Load(),
+		SyncFallbacks:  w.syncFallbacks.Load(),
+		PoolMisses:     w.poolMisses.Load(),
+		Rejected:       w.rejected.Load(),
+		JournalRecords: w.journalRecords.Load(),
+		Journal:        w.journal.Stats(),
+	}
+}
+
+// Close останавливает фоновые горутины и дописывает очередь. Если ctx
+// истекает раньше, запись прерывается: недописанное восстановится из журнала
+// при следующем старте. Журнал закрывает владелец. Create после Close
+// вызывать нельзя.
+func (w *WriteBehind) Close(ctx context.Context) error {
+	close(w.done)
+
+	stopped := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		w.abort()
+		return fmt.Errorf("write-behind: shutdown before queue was persisted: %w", ctx.Err())
+	}
+	w.abort()
+
+	if n := w.Stats().Pending; n > 0 {
+		// журнал не трогаем — записи восстановятся при следующем старте
+		return errors.New("write-behind: some links were not persisted, keeping journal for recovery")
+	}
+	return nil
+}
@@ -0,0 +1,503 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"shortener/internal/cache"
+	"shortener/internal/domain"
+	"shortener/internal/journal"
+	"shortener/internal/logger"
+	"shortener/internal/repo/memory"
+)
+
+func TestWriteBehindPersistsAndResolves(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.New()
+	j, err := journal.Open(t.TempDir(), journal.Options{})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer j.Close()
+
+	wb := NewWriteBehind(repo, j, WriteBehindConfig{PoolSize: 8, FlushInterval: time.Hour}, logger.NewNoopLogger())
+	wb.Start()
+
+	// кэш на одну запись, чтобы второй Resolve шёл мимо кэша
+	svc := NewURLService(repo, cache.NewURLCache(1), logger.NewNoopLogger(), WithWriteBehind(wb))
+
+	res, err := svc.Shorten(ctx, "https://example.com/a", domain.ShortenOptions{})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	code := res.Code
+	if _, err := svc.Shorten(ctx, "https://example.com/b", domain.ShortenOptions{}); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	// в хранилище ссылки ещё нет, но она уже открывается
+	if _, err := repo.GetByCode(ctx, code); !errors.Is(err, domain.ErrURLNotFound) {
+		t.Fatalf("repo before flush: err = %v, want ErrURLNotFound", err)
+	}
+	if r, err := svc.Resolve(ctx, code, domain.Visitor{}); err != nil || r.URL != "https://example.com/a" {
+		t.Fatalf("resolve pending = %q, %v", r.URL, err)
+	}
+
+	if err := wb.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if u, err := repo.GetByCode(ctx, code); err != nil || u.OriginalURL != "https://example.com/a" {
+		t.Fatalf("repo after close = %+v, %v", u, err)
+	}
+	if st := wb.Stats(); st.Persisted != 2 || st.Pending != 0 {
+		t.Fatalf("stats = %+v, want persisted=2 pending=0", st)
+	}
+
+	// журнал очищен: повторное восстановление ничего не находит
+	if n, err := NewWriteBehind(repo, j, WriteBehindConfig{}, logger.NewNoopLogger()).Recover(ctx); err != nil || n != 0 {
+		t.Fatalf("recover after clean close = %d, %v", n, err)
+	}
+}
+
+func TestWriteBehindRecoverFromJournal(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.New()
+	j, err := journal.Open(t.TempDir(), journal.Options{})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer j.Close()
+
+	// "упали" после записи в журнал: одна ссылка успела в БД, другая нет
+	if err := repo.Create(ctx, "saved001", "https://example.com/saved", nil, 0); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	for _, rec := range []journal.Record{
+		{Code: "saved001", URL: "https://example.com/saved", CreatedAt: time.Now()},
+		{Code: "lost0001", URL: "https://example.com/lost", CreatedAt: time.Now()},
+	} {
+		if err := j.Append(rec); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	wb := NewWriteBehind(repo, j, WriteBehindConfig{}, logger.NewNoopLogger())
+	n, err := wb.Recover(ctx)
+	if err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("restored = %d, want 1", n)
+	}
+	if u, err := repo.GetByCode(ctx, "lost0001"); err != nil || u.OriginalURL != "https://example.com/lost" {
+		t.Fatalf("restored link = %+v, %v", u, err)
+	}
+}
+
+func TestWriteBehindDeletedLinkNotReplayed(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.New()
+	dir := t.TempDir()
+	j, err := journal.Open(dir, journal.Options{})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer j.Close()
+
+	wb := NewWriteBehind(repo, j, WriteBehindConfig{PoolSize: 8, FlushInterval: time.Hour}, logger.NewNoopLogger())
+	wb.Start()
+	defer wb.Close(ctx)
+	svc := NewURLService(repo, cache.NewURLCache(16), logger.NewNoopLogger(), WithWriteBehind(wb))
+
+	deleted, err := svc.Shorten(ctx, "https://example.com/deleted", domain.ShortenOptions{})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	kept, err := svc.Shorten(ctx, "https://example.com/kept", domain.ShortenOptions{})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if err := svc.DeleteLink(ctx, deleted.Code); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	// процесс "упал": второй экземпляр видит журнал в том виде, в каком он на диске
+	crashed := t.TempDir()
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatalf("read segment: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(crashed, filepath.Base(f)), data, 0o600); err != nil {
+			t.Fatalf("copy segment: %v", err)
+		}
+	}
+	j2, err := journal.Open(crashed, journal.Options{})
+	if err != nil {
+		t.Fatalf("reopen journal: %v", err)
+	}
+	defer j2.Close()
+
+	n, err := NewWriteBehind(repo, j2, WriteBehindConfig{}, logger.NewNoopLogger()).Recover(ctx)
+	if err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("restored = %d, want 1", n)
+	}
+	if _, err := repo.GetByCode(ctx, deleted.Code); !errors.Is(err, domain.ErrURLNotFound) {
+		t.Fatalf("deleted link after replay: err = %v, want ErrURLNotFound", err)
+	}
+	if _, err := repo.GetByCode(ctx, kept.Code); err != nil {
+		t.Fatalf("kept link after replay: %v", err)
+	}
+}
+
+func TestWriteBehindPendingLookups(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.New()
+	j, err := journal.Open(t.TempDir(), journal.Options{})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer j.Close()
+
+	wb := NewWriteBehind(repo, j, WriteBehindConfig{PoolSize: 8, FlushInterval: time.Hour}, logger.NewNoopLogger())
+	wb.Start()
+	defer wb.Close(ctx)
+	svc := NewURLService(repo, cache.NewURLCache(16), logger.NewNoopLogger(),
+		WithWriteBehind(wb), WithDedup(), WithAnalytics(memory.NewAnalytics()))
+
+	first, err := svc.Shorten(ctx, "https://example.com/a", domain.ShortenOptions{})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	again, err := svc.Shorten(ctx, "https://example.com/a", domain.ShortenOptions{})
+	if err != nil || !again.Existing || again.Code != first.Code {
+		t.Fatalf("dedup of pending link = %+v, %v, want existing %s", again, err, first.Code)
+	}
+
+	now := time.Now()
+	if _, err := svc.Stats(ctx, first.Code, now.Add(-time.Hour), now); err != nil {
+		t.Fatalf("stats of pending link: %v", err)
+	}
+
+	if err := wb.IncrementClicks(ctx, map[string]int64{first.Code: 3}); err != nil {
+		t.Fatalf("increment clicks: %v", err)
+	}
+	if u, err := repo.GetByCode(ctx, first.Code); err != nil || u.ClickCount != 3 {
+		t.Fatalf("link after clicks = %+v, %v, want 3 clicks", u, err)
+	}
+}
+
+var errStorageDown = errors.New("storage is down")
+
+// unavailableRepo — хранилище, которое не отвечает на чтение.
+type unavailableRepo struct {
+	*memory.URLRepository
+}
+
+func (unavailableRepo) GetByCode(context.Context, string) (*domain.URL, error) {
+	return nil, errStorageDown
+}
+
+func TestWriteBehindStorageDown(t *testing.T) {
+	j, err := journal.Open(t.TempDir(), journal.Options{})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer j.Close()
+
+	wb := NewWriteBehind(unavailableRepo{memory.New()}, j, WriteBehindConfig{PoolSize: 8}, logger.NewNoopLogger())
+	wb.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := wb.Create(ctx, "https://example.com/a", nil, 0); !errors.Is(err, errStorageDown) {
+		t.Fatalf("create err = %v, want %v", err, errStorageDown)
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- wb.Close(context.Background()) }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("close: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("close hangs while the pool cannot be refilled")
+	}
+}
+
+func TestWriteBehindMutatePendingLink(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.New()
+	j, err := journal.Open(t.TempDir(), journal.Options{})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer j.Close()
+
+	// фоновая запись не успевает: ссылки остаются в ожидании
+	wb := NewWriteBehind(repo, j, WriteBehindConfig{PoolSize: 8, FlushInterval: time.Hour}, logger.NewNoopLogger())
+	wb.Start()
+	svc := NewURLService(repo, cache.NewURLCache(16), logger.NewNoopLogger(), WithWriteBehind(wb))
+
+	shorten := func(url string) string {
+		t.Helper()
+		res, err := svc.Shorten(ctx, url, domain.ShortenOptions{})
+		if err != nil {
+			t.Fatalf("shorten: %v", err)
+		}
+		return res.Code
+	}
+	phishing := shorten("https://example.com/phishing")
+	deleted := shorten("https://example.com/deleted")
+
+	if err := svc.DisableLink(ctx, phishing, "phishing"); err != nil {
+		t.Fatalf("disable pending link: %v", err)
+	}
+	if _, err := svc.Resolve(ctx, phishing, domain.Visitor{}); !errors.Is(err, domain.ErrURLDisabled) {
+		t.Fatalf("resolve disabled: err = %v, want ErrURLDisabled", err)
+	}
+	if err := svc.DeleteLink(ctx, deleted); err != nil {
+		t.Fatalf("delete pending link: %v", err)
+	}
+	if _, err := svc.Resolve(ctx, deleted, domain.Visitor{}); !errors.Is(err, domain.ErrURLNotFound) {
+		t.Fatalf("resolve deleted: err = %v, want ErrURLNotFound", err)
+	}
+
+	// после записи очереди изменения не откатываются
+	if err := wb.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if u, err := repo.GetByCode(ctx, phishing); err != nil || !u.Disabled {
+		t.Fatalf("disabled link after close = %+v, %v", u, err)
+	}
+	if _, err := repo.GetByCode(ctx, deleted); !errors.Is(err, domain.ErrURLNotFound) {
+		t.Fatalf("deleted link after close: err = %v, want ErrURLNotFound", err)
+	}
+	if st := wb.Stats(); st.Conflicts != 0 || st.Persisted != 2 {
+		t.Fatalf("stats = %+v, want persisted=2 conflicts=0", st)
+	}
+}
+
+func TestWriteBehindAliasAndPendingCodes(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.New()
+	j, err := journal.Open(t.TempDir(), journal.Options{})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer j.Close()
+
+	gen := &seqGenerator{codes: []string{"promo001", "promo002", "promo003"}}
+	wb := NewWriteBehind(repo, j, WriteBehindConfig{Generator: gen, FlushInterval: time.Hour}, logger.NewNoopLogger())
+	wb.Start()
+	svc := NewURLService(repo, cache.NewURLCache(16), logger.NewNoopLogger(), WithCodeGenerator(gen), WithWriteBehind(wb))
+
+	first, err := svc.Shorten(ctx, "https://example.com/async-1", domain.ShortenOptions{})
+	if err != nil || first.Code != "promo001" {
+		t.Fatalf("shorten = %q, %v, want promo001", first.Code, err)
+	}
+	// код уже выдан клиенту, хотя ещё не записан
+	if _, err := svc.Shorten(ctx, "https://example.com/alias", domain.ShortenOptions{Alias: "promo001"}); !errors.Is(err, domain.ErrCodeAlreadyExists) {
+		t.Fatalf("alias over pending code: err = %v, want ErrCodeAlreadyExists", err)
+	}
+
+	// алиас занял следующий код генератора — асинхронное создание его пропускает
+	if _, err := svc.Shorten(ctx, "https://example.com/alias", domain.ShortenOptions{Alias: "promo002"}); err != nil {
+		t.Fatalf("alias: %v", err)
+	}
+	second, err := svc.Shorten(ctx, "https://example.com/async-2", domain.ShortenOptions{})
+	if err != nil || second.Code != "promo003" {
+		t.Fatalf("shorten = %q, %v, want promo003", second.Code, err)
+	}
+
+	if err := wb.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if st := wb.Stats(); st.Conflicts != 0 || st.Persisted != 2 {
+		t.Fatalf("stats = %+v, want persisted=2 conflicts=0", st)
+	}
+	for code, want := range map[string]string{
+		"promo001": "https://example.com/async-1",
+		"promo002": "https://example.com/alias",
+		"promo003": "https://example.com/async-2",
+	} {
+		if u, err := repo.GetByCode(ctx, code); err != nil || u.OriginalURL != want {
+			t.Fatalf("%s = %+v, %v, want %s", code, u, err, want)
+		}
+	}
+}
+
+// batchFailRepo — хранилище, в которое не проходит пакетная запись.
+type batchFailRepo struct {
+	*memory.URLRepository
+}
+
+func (batchFailRepo) CreateBatch(context.Context, []domain.URL) ([]string, error) {
+	return nil, errStorageDown
+}
+
+func TestWriteBehindSyncFallbackFailureRollsBack(t *testing.T) {
+	ctx := context.Background()
+	j, err := journal.Open(t.TempDir(), journal.Options{})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer j.Close()
+
+	// без Start очередь на одну запись не разбирается: второе создание
+	// уходит в синхронную запись
+	wb := NewWriteBehind(batchFailRepo{memory.New()}, j, WriteBehindConfig{QueueSize: 1}, logger.NewNoopLogger())
+	if _, err := wb.Create(ctx, "https://example.com/queued", nil, 0); err != nil {
+		t.Fatalf("create queued: %v", err)
+	}
+	if _, err := wb.Create(ctx, "https://example.com/failed", nil, 0); !errors.Is(err, errStorageDown) {
+		t.Fatalf("create with full queue: err = %v, want %v", err, errStorageDown)
+	}
+
+	// ссылка, о которой клиенту сказали «не создана», не открывается и не восстановится
+	if st := wb.Stats(); st.Pending != 1 || st.Journal.Unconfirmed != 1 {
+		t.Fatalf("stats = %+v, want pending=1 and 1 unconfirmed journal record", st)
+	}
+	var replayed []string
+	if err := j.Records(func(rec journal.Record) error {
+		replayed = append(replayed, rec.URL)
+		return nil
+	}); err != nil {
+		t.Fatalf("records: %v", err)
+	}
+	if len(replayed) != 1 || replayed[0] != "https://example.com/queued" {
+		t.Fatalf("journal records = %v, want only the queued link", replayed)
+	}
+}
+
+// countingRepo считает чтения по коду.
+type countingRepo struct {
+	*memory.URLRepository
+	reads atomic.Int64
+}
+
+func (r *countingRepo) GetByCode(ctx context.Context, code string) (*domain.URL, error) {
+	r.reads.Add(1)
+	return r.URLRepository.GetByCode(ctx, code)
+}
+
+func TestWriteBehindPoolCodesSkipStorage(t *testing.T) {
+	ctx := context.Background()
+	repo := &countingRepo{URLRepository: memory.New()}
+	j, err := journal.Open(t.TempDir(), journal.Options{})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer j.Close()
+
+	// пул заполняем вручную, без фонового пополнения
+	wb := NewWriteBehind(repo, j, WriteBehindConfig{PoolSize: 4}, logger.NewNoopLogger())
+	for _, code := range []string{"pooled01", "pooled02"} {
+		if !wb.reservePool(code) {
+			t.Fatalf("reserve %s", code)
+		}
+		wb.pool <- code
+	}
+
+	code, err := wb.Create(ctx, "https://example.com/a", nil, 0)
+	if err != nil || code != "pooled01" {
+		t.Fatalf("create = %q, %v, want pooled01", code, err)
+	}
+	if n := repo.reads.Load(); n != 0 {
+		t.Fatalf("storage reads for a pool code = %d, want 0", n)
+	}
+
+	// алиас занял код из пула — он больше не выдаётся
+	if err := wb.CreateAlias(ctx, "pooled02", "https://example.com/alias", nil, 0); err != nil {
+		t.Fatalf("alias over pool code: %v", err)
+	}
+	code, err = wb.Create(ctx, "https://example.com/b", nil, 0)
+	if err != nil || code == "pooled02" {
+		t.Fatalf("create = %q, %v, want a code other than the alias", code, err)
+	}
+}
+
+func TestWriteBehindFailingFlushBackpressure(t *testing.T) {
+	ctx := context.Background()
+	j, err := journal.Open(t.TempDir(), journal.Options{})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer j.Close()
+
+	wb := NewWriteBehind(batchFailRepo{memory.New()}, j, WriteBehindConfig{
+		PoolSize:      8,
+		QueueSize:     2,
+		BatchSize:     1,
+		FlushInterval: time.Millisecond,
+	}, logger.NewNoopLogger())
+	wb.Start()
+	defer wb.Close(ctx)
+
+	// пока хранилище не принимает пачки, очередь не разбирается, и
+	// Create упирается в синхронную запись
+	var failed bool
+	for range 20 {
+		if _, err := wb.Create(ctx, "https://example.com/a", nil, 0); errors.Is(err, errStorageDown) {
+			failed = true
+			break
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	if !failed {
+		t.Fatal("create never hit backpressure while flushes fail")
+	}
+	if st := wb.Stats(); st.Pending > 3 {
+		t.Fatalf("pending = %d, want at most one batch and a full queue", st.Pending)
+	}
+}
+
+// stuckRepo — хранилище, в котором пакетная запись висит до отмены контекста.
+type stuckRepo struct {
+	*memory.URLRepository
+}
+
+func (stuckRepo) CreateBatch(ctx context.Context, _ []domain.URL) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestWriteBehindCloseHonorsDeadline(t *testing.T) {
+	j, err := journal.Open(t.TempDir(), journal.Options{})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer j.Close()
+
+	wb := NewWriteBehind(stuckRepo{memory.New()}, j, WriteBehindConfig{PoolSize: 8, FlushInterval: time.Millisecond}, logger.NewNoopLogger())
+	wb.Start()
+	if _, err := wb.Create(context.Background(), "https://example.com/a", nil, 0); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := wb.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("close err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("close took %v, want it bounded by ctx", d)
+	}
+	if n := j.Stats().Unconfirmed; n != 1 {
+		t.Fatalf("unconfirmed = %d, want the link kept for recovery", n)
+	}
+}
@@ -0,0 +1,77 @@
+package trending
+
+import "container/heap"
+
+// spaceSaving — алгоритм Space-Saving (Metwally et al.): держит не больше k
+// счётчиков. Новый ключ при заполнении вытесняет минимальный и наследует его
+// счёт, поэтому частые ключи не теряются, а счёт завышен не более чем на err.
+type spaceSaving struct {
+	k     int
+	index map[string]*ssEntry
+	h     ssHeap
+}
+
+type ssEntry struct {
+	key   string
+	count int64
+	err   int64
+	pos   int
+}
+
+func newSpaceSaving(k int) *spaceSaving {
+	return &spaceSaving{k: k, index: make(map[string]*ssEntry, k)}
+}
+
+func (s *spaceSaving) add(key string, n int64) {
+	if e, ok := s.index[key]; ok {
+		e.count += n
+		heap.Fix(&s.h, e.pos)
+		return
+	}
+
+	if len(s.h) < s.k {
+		e := &ssEntry{key: key, count: n}
+		s.index[key] = e
+		heap.Push(&s.h, e)
+		return
+	}
+
+	// вытесняем минимальный счётчик
+	min := s.h[0]
+	delete(s.index, min.key)
+	min.key = key
+	min.err = min.count
+	min.count += n
+	s.index[key] = min
+	heap.Fix(&s.h, 0)
+}
+
+func (s *spaceSaving) reset() {
+	clear(s.index)
+	s.h = s.h[:0]
+}
+
+// ssHeap — min-heap по count.
+type ssHeap []*ssEntry
+
+func (h ssHeap) Len() int           { return len(h) }
+func (h ssHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h ssHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos = i
+	h[j].pos = j
+}
+
+func (h *ssHeap) Push(x any) {
+	e := x.(*ssEntry)
+	e.pos = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *ssHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	*h = old[:n-1]
+	return e
+}
@@ -0,0 +1,115 @@
+// Package trending находит самые популярные ссылки за скользящее окно без
+// обращения к БД: окно разбито на минутные корзины, в каждой — Space-Saving.
+package trending
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"shortener/internal/domain"
+)
+
+const (
+	bucketSize = time.Minute
+
+	// MaxWindow — самое длинное окно, которое можно запросить.
+	MaxWindow = time.Hour
+)
+
+type bucket struct {
+	minute int64 // номер минуты с начала эпохи; 0 — корзина пуста
+	ss     *spaceSaving
+}
+
+type Tracker struct {
+	mu      sync.Mutex
+	buckets []bucket
+}
+
+// Entry — код и приблизительное число переходов за окно.
+type Entry struct {
+	Code   string
+	Clicks int64
+}
+
+// New создаёт трекер, который помнит до capacity самых частых кодов в каждой минуте.
+func New(capacity int) *Tracker {
+	if capacity <= 0 {
+		capacity = 200
+	}
+	n := int(MaxWindow / bucketSize)
+	t := &Tracker{buckets: make([]bucket, n)}
+	for i := range t.buckets {
+		t.buckets[i].ss = newSpaceSaving(capacity)
+	}
+	return t
+}
+
+// Consume и Close позволяют подключить трекер к конвейеру кликов как Sink.
+func (t *Tracker) Consume(ev domain.ClickEvent) {
+	t.Add(ev.Code, ev.At)
+}
+
+func (t *Tracker) Close(ctx context.Context) error {
+	return nil
+}
+
+// Add учитывает переход по коду в момент at.
+func (t *Tracker) Add(code string, at time.Time) {
+	minute := at.Unix() / int64(bucketSize/time.Second)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := &t.buckets[minute%int64(len(t.buckets))]
+	if b.minute != minute {
+		if minute < b.minute {
+			// событие старше окна (сильно запоздало в очереди)
+			return
+		}
+		b.minute = minute
+		b.ss.reset()
+	}
+	b.ss.add(code, 1)
+}
+
+// Top возвращает до limit самых популярных кодов за window до момента now.
+func (t *Tracker) Top(window time.Duration, limit int, now time.Time) []Entry {
+	if window > MaxWindow {
+		window = MaxWindow
+	}
+	minutes := int64((window + bucketSize - 1) / bucketSize)
+	last := now.Unix() / int64(bucketSize/time.Second)
+	first := last - minutes + 1
+
+	totals := make(map[string]int64)
+
+	t.mu.Lock()
+	for i := range t.buckets {
+		b := &t.buckets[i]
+		if b.minute < first || b.minute > last {
+			continue
+		}
+		for _, e := range b.ss.h {
+			totals[e.key] += e.count
+		}
+	}
+	t.mu.Unlock()
+
+	out := make([]Entry, 0, len(totals))
+	for code, n := range totals {
+		out = append(out, Entry{Code: code, Clicks: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Clicks != out[j].Clicks {
+			return out[i].Clicks > out[j].Clicks
+		}
+		return out[i].Code < out[j].Code
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
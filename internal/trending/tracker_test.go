@@ -0,0 +1,83 @@
+package trending
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"shortener/internal/cache"
+	"shortener/internal/logger"
+	"shortener/internal/repo/memory"
+)
+
+func TestTopSlidingWindow(t *testing.T) {
+	tr := New(10)
+	now := time.Date(2025, 1, 1, 12, 0, 30, 0, time.UTC)
+
+	// 10 минут назад "old" был самым популярным
+	for i := 0; i < 100; i++ {
+		tr.Add("old", now.Add(-10*time.Minute))
+	}
+	for i := 0; i < 5; i++ {
+		tr.Add("hot", now.Add(-time.Minute))
+		tr.Add("hot", now)
+	}
+	tr.Add("warm", now)
+
+	top := tr.Top(5*time.Minute, 20, now)
+	if len(top) != 2 || top[0] != (Entry{Code: "hot", Clicks: 10}) || top[1].Code != "warm" {
+		t.Fatalf("top(5m) = %+v, want hot=10, warm=1", top)
+	}
+
+	top = tr.Top(15*time.Minute, 1, now)
+	if len(top) != 1 || top[0].Code != "old" {
+		t.Fatalf("top(15m, 1) = %+v, want old first", top)
+	}
+}
+
+func TestTopKeepsHeavyHittersUnderPressure(t *testing.T) {
+	tr := New(5)
+	now := time.Now()
+
+	// много редких кодов вперемешку с частыми не вытесняют частые
+	for i := 0; i < 1000; i++ {
+		tr.Add("heavy-a", now)
+		if i%2 == 0 {
+			tr.Add("heavy-b", now)
+		}
+		tr.Add("rare-"+strconv.Itoa(i), now)
+	}
+
+	top := tr.Top(time.Minute, 2, now)
+	if len(top) != 2 || top[0].Code != "heavy-a" || top[1].Code != "heavy-b" {
+		t.Fatalf("top = %+v, want heavy-a, heavy-b", top)
+	}
+	if top[0].Clicks < 1000 {
+		t.Fatalf("heavy-a clicks = %d, want >= 1000 (Space-Saving never underestimates)", top[0].Clicks)
+	}
+}
+
+func TestWarmerLoadsTrendingCodes(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.New()
+	if err := repo.Create(ctx, "hot", "https://example.com/hot", nil, 0); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	c := cache.NewURLCache(10)
+	tr := New(10)
+	tr.Add("hot", time.Now())
+	tr.Add("gone", time.Now())
+
+	w := NewWarmer(tr, repo, c, 5*time.Minute, 10, time.Minute, logger.NewNoopLogger())
+	if n := w.Warm(ctx); n != 1 {
+		t.Fatalf("warmed = %d, want 1", n)
+	}
+	if r, ok := c.Get("hot"); !ok || r.URL != "https://example.com/hot" {
+		t.Fatalf("cache hot = %q, %v", r.URL, ok)
+	}
+	if n := w.Warm(ctx); n != 0 {
+		t.Fatalf("second warm = %d, want 0", n)
+	}
+}
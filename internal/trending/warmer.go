@@ -0,0 +1,93 @@
+package trending
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"shortener/internal/cache"
+	"shortener/internal/domain"
+)
+
+// Warmer периодически подгружает в кэш редиректов популярные коды,
+// которые успели из него вытесниться.
+type Warmer struct {
+	tracker  *Tracker
+	repo     domain.URLRepository
+	cache    *cache.URLCache
+	logger   *slog.Logger
+	window   time.Duration
+	top      int
+	interval time.Duration
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewWarmer(tracker *Tracker, repo domain.URLRepository, c *cache.URLCache, window time.Duration, top int, interval time.Duration, logger *slog.Logger) *Warmer {
+	return &Warmer{
+		tracker:  tracker,
+		repo:     repo,
+		cache:    c,
+		logger:   logger,
+		window:   window,
+		top:      top,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+func (w *Warmer) Start() {
+	w.wg.Add(1)
+	go w.loop()
+}
+
+func (w *Warmer) loop() {
+	defer w.wg.Done()
+
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			ctx, cancel := context.WithTimeout(context.Background(), w.interval)
+			if n := w.Warm(ctx); n > 0 {
+				w.logger.Debug("trending cache warmed", "loaded", n)
+			}
+			cancel()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Warm загружает в кэш отсутствующие в нём популярные коды и возвращает их число.
+func (w *Warmer) Warm(ctx context.Context) int {
+	loaded := 0
+	for _, e := range w.tracker.Top(w.window, w.top, time.Now()) {
+		if w.cache.Contains(e.Code) {
+			continue
+		}
+
+		gen := w.cache.Generation()
+		u, err := w.repo.GetByCode(ctx, e.Code)
+		if err != nil {
+			// истёкшие и удалённые коды просто пропускаем
+			continue
+		}
+		if u.Disabled {
+			continue
+		}
+		if w.cache.SetIfGen(u.Code, u.Redirect(), u.ExpiresAt, gen) {
+			loaded++
+		}
+	}
+	return loaded
+}
+
+func (w *Warmer) Close() {
+	close(w.done)
+	w.wg.Wait()
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"strings"
 	"time"
 
@@ -15,10 +17,20 @@ import (
 type Handler struct {
 	svc    domain.URLService
 	logger *slog.Logger
+
+	baseURL        string // со слэшем на конце; пусто — строим из запроса
+	basePath       string
+	trustedProxies []netip.Prefix
+	ipSalt         []byte
+	normalizeCode  func(string) string
 }
 
-func NewHandler(svc domain.URLService, logger *slog.Logger) *Handler {
-	return &Handler{svc: svc, logger: logger}
+func NewHandler(svc domain.URLService, logger *slog.Logger, opts ...Option) *Handler {
+	h := &Handler{svc: svc, logger: logger, basePath: "/"}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // RegisterRoutes регистрирует маршруты на стандартном ServeMux.
@@ -26,17 +38,30 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	// /api/v1/shorten — только POST
 	mux.HandleFunc("/api/v1/shorten", h.handleShorten)
 
+	// /api/v1/links/{code} — управление конкретной ссылкой
+	mux.HandleFunc("/api/v1/links/", h.handleLinks)
+
+	// /api/v1/trending?window=5m&limit=20 — популярные ссылки
+	mux.HandleFunc("/api/v1/trending", h.handleTrending)
+
 	// /{short_key} — всё остальное, начинающееся с "/" (корень)
 	// Внутри handleResolve мы сами парсим path и делаем 404 при необходимости.
 	mux.HandleFunc("/", h.handleResolve)
 }
 
 type shortenRequest struct {
-	URL string `json:"url"`
+	URL       string     `json:"url"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // RFC 3339
+	TTL       string     `json:"ttl,omitempty"`        // например "72h"
+	Alias     string     `json:"alias,omitempty"`
+	// RedirectStatus — 301, 302, 307 или 308; по умолчанию — из конфигурации
+	RedirectStatus int `json:"redirect_status,omitempty"`
 }
 
 type shortenResponse struct {
-	ShortURL string `json:"short_url"`
+	ShortURL       string     `json:"short_url"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	RedirectStatus int        `json:"redirect_status"`
 }
 
 func (h *Handler) handleShorten(w http.ResponseWriter, r *http.Request) {
@@ -61,25 +86,89 @@ func (h *Handler) handleShorten(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	expiresAt, err := req.expiry(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
 	defer cancel()
 
-	code, err := h.svc.Shorten(ctx, req.URL, nil)
+	_, host := h.origin(r)
+	res, err := h.svc.Shorten(ctx, req.URL, domain.ShortenOptions{
+		ExpiresAt: expiresAt,
+		Alias:     req.Alias,
+		Host:      host,
+
+		RedirectStatus: req.RedirectStatus,
+	})
 	if err != nil {
+		var urlErr *domain.URLError
+		switch {
+		case errors.As(err, &urlErr):
+			writeURLError(w, urlErr)
+			return
+		case errors.Is(err, domain.ErrInvalidExpiry), errors.Is(err, domain.ErrInvalidAlias), errors.Is(err, domain.ErrInvalidRedirect):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case req.Alias != "" && errors.Is(err, domain.ErrCodeAlreadyExists):
+			// для случайных кодов это исчерпание попыток — 500 ниже
+			http.Error(w, "alias already taken", http.StatusConflict)
+			return
+		}
 		h.logger.Error("shorten failed", "err", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
-	scheme := "http"
-	if r.TLS != nil {
-		scheme = "https"
+	shortURL := h.shortURL(r, res.Code)
+
+	// 201 Created для новой ссылки, 200 — если вернули уже существующую
+	status := http.StatusCreated
+	if res.Existing {
+		status = http.StatusOK
 	}
-	shortURL := scheme + "://" + r.Host + "/" + code
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated) // 201 Created
-	_ = json.NewEncoder(w).Encode(shortenResponse{ShortURL: shortURL})
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(shortenResponse{ShortURL: shortURL, ExpiresAt: res.ExpiresAt, RedirectStatus: res.RedirectStatus})
+}
+
+// urlErrorResponse — тело ответа 422: какое правило проверки адреса нарушено.
+type urlErrorResponse struct {
+	Error  string `json:"error"`
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+}
+
+// writeURLError отвечает 422 Unprocessable Entity с описанием нарушенного правила.
+func writeURLError(w http.ResponseWriter, e *domain.URLError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_ = json.NewEncoder(w).Encode(urlErrorResponse{Error: "invalid url", Rule: e.Rule, Reason: e.Reason})
+}
+
+// expiry вычисляет срок жизни ссылки из expires_at или ttl (указать можно только одно).
+func (req *shortenRequest) expiry(now time.Time) (*time.Time, error) {
+	switch {
+	case req.ExpiresAt != nil && req.TTL != "":
+		return nil, errors.New("only one of expires_at and ttl may be set")
+	case req.ExpiresAt != nil:
+		t := req.ExpiresAt.UTC()
+		return &t, nil
+	case req.TTL != "":
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl: %w", err)
+		}
+		if d <= 0 {
+			return nil, errors.New("ttl must be positive")
+		}
+		t := now.Add(d).UTC()
+		return &t, nil
+	}
+	return nil, nil
 }
 
 func (h *Handler) handleResolve(w http.ResponseWriter, r *http.Request) {
@@ -101,8 +190,11 @@ func (h *Handler) handleResolve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Обрезаем ведущий "/"
+	// Обрезаем ведущий "/" или префикс пути из базового URL (если прокси его не срезал)
 	code := strings.TrimPrefix(path, "/")
+	if h.basePath != "/" && strings.HasPrefix(path, h.basePath) {
+		code = strings.TrimPrefix(path, h.basePath)
+	}
 
 	// Не допускаем дополнительных слэшей: "/a/b" → 404
 	if code == "" || strings.Contains(code, "/") {
@@ -113,17 +205,66 @@ func (h *Handler) handleResolve(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 200*time.Millisecond)
 	defer cancel()
 
-	originalURL, err := h.svc.Resolve(ctx, code)
+	target, err := h.resolve(ctx, code, h.visitor(r))
 	if err != nil {
+		var typo *domain.TypoError
+		if errors.As(err, &typo) && len(typo.Suggestions) > 0 {
+			h.writeSuggestions(w, r, typo.Suggestions)
+			return
+		}
 		if errors.Is(err, domain.ErrURLNotFound) {
 			http.NotFound(w, r)
 			return
 		}
+		if errors.Is(err, domain.ErrURLDisabled) {
+			http.Error(w, "short url disabled", http.StatusGone)
+			return
+		}
+		if errors.Is(err, domain.ErrURLBlocked) {
+			http.Error(w, "destination blocked", http.StatusUnavailableForLegalReasons)
+			return
+		}
 		h.logger.Error("resolve failed", "err", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
-	// 301 Permanent Redirect
-	http.Redirect(w, r, originalURL, http.StatusMovedPermanently)
+	w.Header().Set("Cache-Control", redirectCacheControl(target.Status))
+	http.Redirect(w, r, target.URL, target.Status)
+}
+
+// permanentRedirectMaxAge — сколько браузеры и прокси могут хранить постоянный
+// редирект. Без ограничения браузер запоминает 301/308 навсегда, и смена
+// адреса ссылки до него уже не дойдёт.
+const permanentRedirectMaxAge = 24 * time.Hour
+
+// redirectCacheControl подбирает Cache-Control под статус: постоянный
+// редирект можно кэшировать, временный — нет, чтобы каждый переход доходил
+// до сервиса и смена адреса или истечение срока действовали сразу.
+func redirectCacheControl(status int) string {
+	if domain.PermanentRedirect(status) {
+		return fmt.Sprintf("public, max-age=%d", int(permanentRedirectMaxAge.Seconds()))
+	}
+	return "no-store"
+}
+
+// resolve ищет код в каноническом виде (регистр, похожие символы): в нём
+// хранятся и сгенерированные коды, и пользовательские алиасы.
+func (h *Handler) resolve(ctx context.Context, code string, v domain.Visitor) (domain.Redirect, error) {
+	if h.normalizeCode != nil {
+		code = h.normalizeCode(code)
+	}
+	return h.svc.Resolve(ctx, code, v)
+}
+
+// writeSuggestions отвечает 404 со списком похожих существующих ссылок.
+func (h *Handler) writeSuggestions(w http.ResponseWriter, r *http.Request, codes []string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusNotFound)
+
+	fmt.Fprintln(w, "short url not found, did you mean:")
+	for _, c := range codes {
+		fmt.Fprintln(w, h.shortURL(r, c))
+	}
 }
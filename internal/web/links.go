@@ -0,0 +1,190 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"shortener/internal/domain"
+)
+
+type linkResponse struct {
+	Code        string     `json:"code"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	ClickCount  int64      `json:"click_count"`
+	Version     int64      `json:"version"`
+
+	Disabled       bool   `json:"disabled"`
+	DisabledReason string `json:"disabled_reason,omitempty"`
+
+	RedirectStatus int `json:"redirect_status"`
+}
+
+// patchLinkRequest — частичное изменение ссылки; отсутствующие поля не трогаем.
+type patchLinkRequest struct {
+	URL      string `json:"url,omitempty"`
+	Disabled *bool  `json:"disabled,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// handleLinks обслуживает /api/v1/links/{code} и /api/v1/links/{code}/stats.
+func (h *Handler) handleLinks(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimPrefix(r.URL.Path, "/api/v1/links/")
+	if c, ok := strings.CutSuffix(code, "/stats"); ok {
+		if c == "" || strings.Contains(c, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleLinkStats(w, r, c)
+		return
+	}
+	if code == "" || strings.Contains(code, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.handleGetLink(w, r, code)
+	case http.MethodPatch:
+		h.handlePatchLink(w, r, code)
+	case http.MethodDelete:
+		h.handleDeleteLink(w, r, code)
+	default:
+		w.Header().Set("Allow", "GET, PATCH, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) handleGetLink(w http.ResponseWriter, r *http.Request, code string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+	defer cancel()
+
+	u, err := h.svc.GetLink(ctx, code)
+	if err != nil {
+		h.writeLinkError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(u.Version))
+	_ = json.NewEncoder(w).Encode(h.newLinkResponse(r, u))
+}
+
+func (h *Handler) handlePatchLink(w http.ResponseWriter, r *http.Request, code string) {
+	var req patchLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if req.URL == "" && req.Disabled == nil {
+		http.Error(w, "nothing to update", http.StatusBadRequest)
+		return
+	}
+
+	ifVersion, ok := parseIfMatch(r.Header.Get("If-Match"))
+	if !ok {
+		http.Error(w, "invalid If-Match", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+	defer cancel()
+
+	// адрес и отключение меняются одной условной записью: либо всё, либо ничего
+	_, host := h.origin(r)
+	upd := domain.LinkUpdate{Disabled: req.Disabled, DisabledReason: req.Reason, Host: host}
+	if req.URL != "" {
+		upd.OriginalURL = &req.URL
+	}
+	if err := h.svc.UpdateLink(ctx, code, upd, ifVersion); err != nil {
+		h.writeLinkError(w, r, err)
+		return
+	}
+
+	h.handleGetLink(w, r, code)
+}
+
+// etag формирует сильный ETag из версии ссылки.
+func etag(version int64) string {
+	return `"v` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseIfMatch возвращает ожидаемую версию из If-Match; 0 — без условия (пусто или "*").
+func parseIfMatch(v string) (int64, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" || v == "*" {
+		return 0, true
+	}
+	v = strings.TrimPrefix(v, "W/")
+	if !strings.HasPrefix(v, `"v`) || !strings.HasSuffix(v, `"`) || len(v) < 4 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v[2:len(v)-1], 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+func (h *Handler) handleDeleteLink(w http.ResponseWriter, r *http.Request, code string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+	defer cancel()
+
+	if err := h.svc.DeleteLink(ctx, code); err != nil {
+		h.writeLinkError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) newLinkResponse(r *http.Request, u *domain.URL) linkResponse {
+	return linkResponse{
+		Code:        u.Code,
+		ShortURL:    h.shortURL(r, u.Code),
+		OriginalURL: u.OriginalURL,
+		CreatedAt:   u.CreatedAt,
+		ExpiresAt:   u.ExpiresAt,
+		ClickCount:  u.ClickCount,
+		Version:     u.Version,
+
+		Disabled:       u.Disabled,
+		DisabledReason: u.DisabledReason,
+
+		RedirectStatus: u.Redirect().Status,
+	}
+}
+
+// writeLinkError отображает ошибки поиска ссылки в HTTP-статусы.
+func (h *Handler) writeLinkError(w http.ResponseWriter, r *http.Request, err error) {
+	var urlErr *domain.URLError
+	switch {
+	case errors.As(err, &urlErr):
+		writeURLError(w, urlErr)
+	case errors.Is(err, domain.ErrURLNotFound):
+		http.NotFound(w, r)
+	case errors.Is(err, domain.ErrURLExpired):
+		http.Error(w, "short url expired", http.StatusGone)
+	case errors.Is(err, domain.ErrVersionConflict):
+		http.Error(w, "version mismatch", http.StatusPreconditionFailed)
+	case errors.Is(err, domain.ErrInvalidPeriod):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, domain.ErrStatsDisabled):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	default:
+		h.logger.Error("link lookup failed", "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
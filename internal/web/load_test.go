@@ -225,7 +225,7 @@ func TestShortener_Load_BothRepos(t *testing.T) {
 						defer wgRead.Done()
 						loc := doResolve(t, client, ts.URL, code)
 						if loc == "" {
-							t.Fatalf("empty redirect location for code=%s", code)
+							t.Errorf("empty redirect location for code=%s", code)
 						}
 					}(code)
 				}
@@ -0,0 +1,81 @@
+package web
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+type Option func(*Handler)
+
+// WithBaseURL задаёт публичный адрес, от которого строятся short_url.
+// Допускается префикс пути, например https://go.example.com/s/.
+func WithBaseURL(u *url.URL) Option {
+	return func(h *Handler) {
+		if u == nil || u.Host == "" {
+			return
+		}
+		h.basePath = "/" + strings.Trim(u.Path, "/")
+		if h.basePath != "/" {
+			h.basePath += "/"
+		}
+		h.baseURL = u.Scheme + "://" + u.Host + h.basePath
+	}
+}
+
+// WithTrustedProxies разрешает брать схему и хост из X-Forwarded-Proto/X-Forwarded-Host,
+// если запрос пришёл с адреса из перечисленных подсетей. Используется только
+// когда базовый URL не задан.
+func WithTrustedProxies(prefixes []netip.Prefix) Option {
+	return func(h *Handler) {
+		h.trustedProxies = prefixes
+	}
+}
+
+// WithIPHashSalt задаёт соль для хэширования IP клиентов в аналитике.
+func WithIPHashSalt(salt []byte) Option {
+	return func(h *Handler) {
+		h.ipSalt = salt
+	}
+}
+
+// WithCodeNormalizer задаёт приведение кода из адреса к каноническому виду
+// перед поиском (например, регистр и похожие символы в base32 Крокфорда).
+func WithCodeNormalizer(fn func(string) string) Option {
+	return func(h *Handler) {
+		h.normalizeCode = fn
+	}
+}
+
+// ParseTrustedProxies разбирает список CIDR (одиночный адрес допускается без маски).
+func ParseTrustedProxies(cidrs []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(cidrs))
+	for _, c := range cidrs {
+		p, err := netip.ParsePrefix(c)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(c)
+			if aerr != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", c, err)
+			}
+			p = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
+// ParseBaseURL проверяет, что базовый URL абсолютный и использует http(s).
+func ParseBaseURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse base url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("base url %q: scheme must be http or https", raw)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("base url %q: host is required", raw)
+	}
+	return u, nil
+}
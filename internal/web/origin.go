@@ -0,0 +1,79 @@
+package web
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// shortURL строит полный адрес короткой ссылки.
+// Приоритет: настроенный базовый URL, затем X-Forwarded-* от доверенного прокси,
+// затем Host и TLS самого запроса.
+func (h *Handler) shortURL(r *http.Request, code string) string {
+	if h.baseURL != "" {
+		return h.baseURL + code
+	}
+	scheme, host := h.origin(r)
+	return scheme + "://" + host + "/" + code
+}
+
+// origin возвращает схему и хост, по которым клиент обратился к сервису:
+// X-Forwarded-* от доверенного прокси, иначе Host и TLS самого запроса.
+func (h *Handler) origin(r *http.Request) (scheme, host string) {
+	scheme = "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host = r.Host
+
+	if h.fromTrustedProxy(r) {
+		if v := lastHeaderValue(r, "X-Forwarded-Proto"); v == "http" || v == "https" {
+			scheme = v
+		}
+		if v := lastHeaderValue(r, "X-Forwarded-Host"); v != "" {
+			host = v
+		}
+	}
+	return scheme, host
+}
+
+func (h *Handler) fromTrustedProxy(r *http.Request) bool {
+	if len(h.trustedProxies) == 0 {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	return h.isTrustedProxy(addr.Unmap())
+}
+
+func (h *Handler) isTrustedProxy(addr netip.Addr) bool {
+	for _, p := range h.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// lastHeaderValue возвращает последнее значение заголовка (строки и списки
+// через запятую): его дописал ближайший, доверенный прокси, а левые значения
+// клиент может подставить сам.
+func lastHeaderValue(r *http.Request, name string) string {
+	values := r.Header.Values(name)
+	if len(values) == 0 {
+		return ""
+	}
+	v := values[len(values)-1]
+	if i := strings.LastIndexByte(v, ','); i >= 0 {
+		v = v[i+1:]
+	}
+	return strings.ToLower(strings.TrimSpace(v))
+}
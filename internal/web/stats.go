@@ -0,0 +1,170 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"shortener/internal/domain"
+)
+
+const (
+	defaultStatsPeriod    = 7 * 24 * time.Hour
+	defaultTrendingWindow = 5 * time.Minute
+	defaultTrendingLimit  = 20
+)
+
+type statsBucket struct {
+	Start   time.Time `json:"start"`
+	Clicks  int64     `json:"clicks"`
+	Uniques *int64    `json:"uniques,omitempty"`
+}
+
+type statsEntry struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+type statsResponse struct {
+	Code           string        `json:"code"`
+	From           time.Time     `json:"from"`
+	To             time.Time     `json:"to"`
+	TotalClicks    int64         `json:"total_clicks"`
+	UniqueVisitors int64         `json:"unique_visitors"`
+	Hourly         []statsBucket `json:"hourly"`
+	Daily          []statsBucket `json:"daily"`
+	TopReferrers   []statsEntry  `json:"top_referrers"`
+	TopBrowsers    []statsEntry  `json:"top_browsers"`
+}
+
+// handleLinkStats отдаёт GET /api/v1/links/{code}/stats?from=...&to=... (RFC 3339).
+// По умолчанию — последние 7 дней.
+func (h *Handler) handleLinkStats(w http.ResponseWriter, r *http.Request, code string) {
+	to := time.Now().UTC()
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	from := to.Add(-defaultStatsPeriod)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	st, err := h.svc.Stats(ctx, code, from, to)
+	if err != nil {
+		h.writeLinkError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newStatsResponse(st))
+}
+
+type trendingLink struct {
+	Code     string `json:"code"`
+	ShortURL string `json:"short_url"`
+	Clicks   int64  `json:"clicks"`
+}
+
+type trendingResponse struct {
+	Window string         `json:"window"`
+	Links  []trendingLink `json:"links"`
+}
+
+func (h *Handler) handleTrending(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window := defaultTrendingWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			http.Error(w, "invalid window: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	limit := defaultTrendingLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	links, err := h.svc.Trending(r.Context(), window, limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidPeriod):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, domain.ErrTrendingDisabled):
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+		default:
+			h.logger.Error("trending failed", "err", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	resp := trendingResponse{Window: window.String(), Links: make([]trendingLink, len(links))}
+	for i, l := range links {
+		resp.Links[i] = trendingLink{Code: l.Code, ShortURL: h.shortURL(r, l.Code), Clicks: l.Clicks}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func newStatsResponse(st *domain.LinkStats) statsResponse {
+	return statsResponse{
+		Code:           st.Code,
+		From:           st.From,
+		To:             st.To,
+		TotalClicks:    st.TotalClicks,
+		UniqueVisitors: st.UniqueVisitors,
+		Hourly:         toStatsBuckets(st.Hourly, false),
+		Daily:          toStatsBuckets(st.Daily, true),
+		TopReferrers:   toStatsEntries(st.TopReferrers),
+		TopBrowsers:    toStatsEntries(st.TopBrowsers),
+	}
+}
+
+// toStatsBuckets конвертирует ряд; uniques есть только у дневного ряда.
+func toStatsBuckets(in []domain.StatsBucket, withUniques bool) []statsBucket {
+	out := make([]statsBucket, len(in))
+	for i, b := range in {
+		out[i] = statsBucket{Start: b.Start, Clicks: b.Clicks}
+		if withUniques {
+			out[i].Uniques = &in[i].Uniques
+		}
+	}
+	return out
+}
+
+func toStatsEntries(in []domain.CountEntry) []statsEntry {
+	out := make([]statsEntry, len(in))
+	for i, e := range in {
+		out[i] = statsEntry{Key: e.Key, Count: e.Count}
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"shortener/internal/domain"
+)
+
+// visitor извлекает из запроса обезличенные данные для аналитики.
+func (h *Handler) visitor(r *http.Request) domain.Visitor {
+	v := domain.Visitor{
+		ReferrerHost: referrerHost(r.Referer()),
+		Browser:      browserClass(r.UserAgent()),
+		Language:     primaryLanguage(r.Header.Get("Accept-Language")),
+	}
+	if ip := h.clientIP(r); ip.IsValid() {
+		hash := sha256.New()
+		hash.Write(h.ipSalt)
+		hash.Write([]byte(ip.String()))
+		v.IPHash = hex.EncodeToString(hash.Sum(nil)[:16])
+
+		// отдельный хэш с полным User-Agent: разные устройства за одним NAT — разные посетители
+		hash.Write([]byte{0})
+		hash.Write([]byte(r.UserAgent()))
+		v.Fingerprint = hex.EncodeToString(hash.Sum(nil))
+	}
+	return v
+}
+
+// clientIP возвращает адрес клиента. За доверенными прокси идём по X-Forwarded-For
+// справа налево и берём первый адрес, не принадлежащий прокси: левые значения
+// клиент может подставить сам.
+func (h *Handler) clientIP(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	addr = addr.Unmap()
+
+	if !h.isTrustedProxy(addr) {
+		return addr
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !h.isTrustedProxy(addr) {
+			break
+		}
+	}
+	return addr
+}
+
+func referrerHost(ref string) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// browserClass грубо классифицирует User-Agent. Порядок проверок важен:
+// Edge и Opera содержат "Chrome", а Chrome — "Safari".
+func browserClass(ua string) string {
+	if ua == "" {
+		return "unknown"
+	}
+	l := strings.ToLower(ua)
+	switch {
+	case strings.Contains(l, "bot"), strings.Contains(l, "crawler"), strings.Contains(l, "spider"),
+		strings.HasPrefix(l, "curl/"), strings.HasPrefix(l, "wget/"):
+		return "bot"
+	case strings.Contains(l, "edg/"):
+		return "edge"
+	case strings.Contains(l, "opr/"), strings.Contains(l, "opera"):
+		return "opera"
+	case strings.Contains(l, "firefox/"):
+		return "firefox"
+	case strings.Contains(l, "chrome/"), strings.Contains(l, "crios/"):
+		return "chrome"
+	case strings.Contains(l, "safari/"):
+		return "safari"
+	default:
+		return "other"
+	}
+}
+
+// primaryLanguage берёт первый тег из Accept-Language ("ru-RU,ru;q=0.9" → "ru-ru").
+func primaryLanguage(h string) string {
+	if i := strings.IndexAny(h, ",;"); i >= 0 {
+		h = h[:i]
+	}
+	h = strings.ToLower(strings.TrimSpace(h))
+	if len(h) > 16 || h == "*" {
+		return ""
+	}
+	return h
+}